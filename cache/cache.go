@@ -0,0 +1,45 @@
+// Package cache stores command responses with Redis and in-memory backends
+package cache
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Store keeps values for a limited time
+type Store interface {
+	// Get returns the value stored at key, ok is false if there is none or it has expired
+	Get(ctx context.Context, key string) (value []byte, ok bool, err error)
+	// Set stores the value at key for ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// fallbackStore uses the primary store and switches to the fallback when the primary fails
+type fallbackStore struct {
+	primary  Store
+	fallback Store
+}
+
+// WithFallback returns a store that uses fallback whenever primary returns an error
+func WithFallback(primary, fallback Store) Store {
+	return &fallbackStore{primary: primary, fallback: fallback}
+}
+
+func (f *fallbackStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, ok, err := f.primary.Get(ctx, key)
+	if err != nil {
+		log.Warnf("Cache get failed, using fallback: %v", err)
+		return f.fallback.Get(ctx, key)
+	}
+	return value, ok, nil
+}
+
+func (f *fallbackStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := f.primary.Set(ctx, key, value, ttl); err != nil {
+		log.Warnf("Cache set failed, using fallback: %v", err)
+		return f.fallback.Set(ctx, key, value, ttl)
+	}
+	return nil
+}
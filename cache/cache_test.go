@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	if _, ok, _ := store.Get(ctx, "ep:mandalorian"); ok {
+		t.Fatal("Get() found a value in an empty cache")
+	}
+
+	_ = store.Set(ctx, "ep:mandalorian", []byte("value"), time.Minute)
+
+	now = now.Add(59 * time.Second)
+	if value, ok, _ := store.Get(ctx, "ep:mandalorian"); !ok || string(value) != "value" {
+		t.Errorf("Get() = %q, %v, want value before expiry", value, ok)
+	}
+
+	now = now.Add(time.Second)
+	if _, ok, _ := store.Get(ctx, "ep:mandalorian"); ok {
+		t.Error("Get() returned an expired value")
+	}
+}
+
+type brokenStore struct{}
+
+func (brokenStore) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func (brokenStore) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("connection refused")
+}
+
+func TestWithFallback(t *testing.T) {
+	ctx := context.Background()
+	store := WithFallback(brokenStore{}, NewMemoryStore())
+
+	if err := store.Set(ctx, "key", []byte("value"), time.Minute); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	value, ok, err := store.Get(ctx, "key")
+	if err != nil || !ok || string(value) != "value" {
+		t.Errorf("Get() = %q, %v, %v, want value from fallback", value, ok, err)
+	}
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+// MemoryStore keeps values in process memory, they survive only as long as the warm Lambda instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	// now is replaceable for tests
+	now func() time.Time
+}
+
+// NewMemoryStore returns an empty in-memory cache
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]entry),
+		now:     time.Now,
+	}
+}
+
+// Get returns the value at key if it hasn't expired
+func (m *MemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if !m.now().Before(e.expires) {
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	return e.value, true, nil
+}
+
+// Set stores the value at key for ttl, expired entries are removed at the same time
+func (m *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for k, e := range m.entries {
+		if !now.Before(e.expires) {
+			delete(m.entries, k)
+		}
+	}
+
+	m.entries[key] = entry{value: value, expires: now.Add(ttl)}
+	return nil
+}
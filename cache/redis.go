@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps values in Redis so they are shared between Lambda instances
+type RedisStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedisStore returns a store keeping values under "cache:" in the given Redis
+func NewRedisStore(client redis.Cmdable) *RedisStore {
+	return &RedisStore{client: client, prefix: "cache:"}
+}
+
+// Get returns the value at key
+func (r *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := r.client.Get(ctx, r.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores the value at key for ttl
+func (r *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, r.prefix+key, value, ttl).Err()
+}
@@ -0,0 +1,199 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/lambda"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// anyone matches every source or user in cost models
+const anyone = "*"
+
+// vatRate is the VAT percentage in effect from a date on, in the time zone of the zone
+type vatRate struct {
+	// From is the first day of the rate as YYYY-MM-DD, empty for the earliest known rate
+	From    string
+	Percent float64
+}
+
+// vat returns the VAT multiplier in effect in the zone at t
+func (z zone) vat(t time.Time) float64 {
+	day := t.In(z.Location).Format(time.DateOnly)
+
+	var percent float64
+	for _, rate := range z.VAT {
+		if rate.From <= day {
+			percent = rate.Percent
+		}
+	}
+	return 1 + percent/100
+}
+
+// withVAT returns the spot prices with the VAT of their own time included
+func (z zone) withVAT(slots []priceSlot) []priceSlot {
+	res := make([]priceSlot, len(slots))
+	for i, slot := range slots {
+		slot.Price *= z.vat(slot.Start)
+		res[i] = slot
+	}
+	return res
+}
+
+// costModel is what a consumer pays on top of the spot price, all amounts are c/kWh without VAT.
+// Entries are picked by source and user, * matches any and the most specific entry wins.
+type costModel struct {
+	Source string `json:"source,omitempty"`
+	User   string `json:"user,omitempty"`
+	// Margin is the retailer's margin
+	Margin float64 `json:"margin"`
+	// Transfer is the grid transfer fee
+	Transfer float64 `json:"transfer"`
+	// NightTransfer replaces Transfer during NightHours on time-of-day tariffs
+	NightTransfer float64 `json:"night_transfer,omitempty"`
+	// NightHours is the local time night of the tariff, e.g. "22-07"
+	NightHours string `json:"night_hours,omitempty"`
+	// Tax is the electricity tax, with the security of supply fee
+	Tax float64 `json:"tax"`
+
+	nightStart, nightEnd int
+}
+
+// specificity orders matching entries: a user in a source, a user anywhere, a source, everyone
+func (c *costModel) specificity() int {
+	n := 0
+	if c.User != anyone {
+		n += 2
+	}
+	if c.Source != anyone {
+		n++
+	}
+	return n
+}
+
+// matches reports whether the entry applies to the user in the source
+func (c *costModel) matches(source, user string) bool {
+	return (c.Source == anyone || c.Source == source) && (c.User == anyone || c.User == user)
+}
+
+// night reports whether t is within the night hours of a time-of-day tariff in the zone
+func (c *costModel) night(z zone, t time.Time) bool {
+	if c.NightHours == "" {
+		return false
+	}
+	hour := t.In(z.Location).Hour()
+	if c.nightStart > c.nightEnd {
+		return hour >= c.nightStart || hour < c.nightEnd
+	}
+	return hour >= c.nightStart && hour < c.nightEnd
+}
+
+// apply returns the consumer prices of the spot prices in the zone, with the costs and VAT included
+func (c *costModel) apply(z zone, slots []priceSlot) []priceSlot {
+	res := make([]priceSlot, len(slots))
+	for i, slot := range slots {
+		transfer := c.Transfer
+		if c.night(z, slot.Start) {
+			transfer = c.NightTransfer
+		}
+		slot.Price = (slot.Price + c.Margin + transfer + c.Tax) * z.vat(slot.Start)
+		res[i] = slot
+	}
+	return res
+}
+
+// parseNightHours parses a range of hours like "22-07"
+func parseNightHours(value string) (int, int, error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid night hours %q, use e.g. 22-07", value)
+	}
+	start, err := strconv.Atoi(from)
+	if err != nil || start < 0 || start > 23 {
+		return 0, 0, fmt.Errorf("invalid night hours %q, use e.g. 22-07", value)
+	}
+	end, err := strconv.Atoi(to)
+	if err != nil || end < 0 || end > 23 || end == start {
+		return 0, 0, fmt.Errorf("invalid night hours %q, use e.g. 22-07", value)
+	}
+	return start, end, nil
+}
+
+// parseCosts parses the JSON array of cost models in ELECTRICITY_COSTS
+func parseCosts(value string) ([]*costModel, error) {
+	var models []*costModel
+	if err := json.Unmarshal([]byte(value), &models); err != nil {
+		return nil, fmt.Errorf("invalid cost models: %w", err)
+	}
+
+	for _, c := range models {
+		if c.Source == "" {
+			c.Source = anyone
+		}
+		if c.User == "" {
+			c.User = anyone
+		}
+		if c.NightHours != "" {
+			start, end, err := parseNightHours(c.NightHours)
+			if err != nil {
+				return nil, err
+			}
+			c.nightStart, c.nightEnd = start, end
+		}
+	}
+	return models, nil
+}
+
+func validCosts(value string) error {
+	_, err := parseCosts(value)
+	return err
+}
+
+// costsFor returns the most specific cost model of the user in the source and its position in ELECTRICITY_COSTS.
+// Returns nil if there's no model for them, then only spot prices are shown.
+func costsFor(source, user string) (*costModel, int) {
+	value := config.Get("ELECTRICITY_COSTS")
+	if value == "" {
+		return nil, -1
+	}
+
+	models, err := parseCosts(value)
+	if err != nil {
+		log.Warnf("Ignoring ELECTRICITY_COSTS: %v", err)
+		return nil, -1
+	}
+
+	var (
+		best  *costModel
+		index = -1
+	)
+	for i, c := range models {
+		// later entries win among equally specific ones
+		if c.matches(source, user) && (best == nil || c.specificity() >= best.specificity()) {
+			best, index = c, i
+		}
+	}
+	return best, index
+}
+
+// costsCacheVary keeps the cached results of users with different cost models apart
+func costsCacheVary(cmd *lambda.Command) string {
+	if _, index := costsFor(cmd.Source, cmd.User); index >= 0 {
+		return "costs" + strconv.Itoa(index)
+	}
+	return ""
+}
+
+func init() {
+	config.Register(config.Setting{
+		Key:         "ELECTRICITY_COSTS",
+		Description: `JSON array of consumer costs for sahko in c/kWh without VAT, e.g. [{"margin":0.49,"transfer":4.2,"night_transfer":2.4,"night_hours":"22-07","tax":2.253}], "source" and "user" pick who they apply to`,
+		Validate:    validCosts,
+	})
+}
@@ -0,0 +1,131 @@
+package command
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/lambda"
+)
+
+func TestZoneVAT(t *testing.T) {
+	estonia, _ := lookupZone("EE")
+	northernNorway, _ := lookupZone("NO4")
+
+	tests := []struct {
+		name string
+		zone zone
+		t    time.Time
+		want float64
+	}{
+		{"before the temporary cut", finland, time.Date(2022, 11, 30, 21, 59, 0, 0, time.UTC), 1.24},
+		{"temporary cut starts at midnight in Helsinki", finland, time.Date(2022, 11, 30, 22, 0, 0, 0, time.UTC), 1.10},
+		{"after the temporary cut", finland, time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC), 1.24},
+		{"raised to 25.5", finland, time.Date(2024, 8, 31, 21, 0, 0, 0, time.UTC), 1.255},
+		{"earliest known rate", estonia, time.Date(2023, 12, 31, 12, 0, 0, 0, time.UTC), 1.20},
+		{"raised to 22", estonia, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), 1.22},
+		{"no VAT", northernNorway, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.zone.vat(tt.t); got != tt.want {
+				t.Errorf("vat() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCostsFor(t *testing.T) {
+	t.Setenv("ELECTRICITY_COSTS", `[
+		{"margin": 1},
+		{"source": "#sauna", "margin": 2},
+		{"user": "nick", "margin": 3},
+		{"source": "#sauna", "user": "nick", "margin": 4},
+		{"source": "#sauna", "margin": 5}
+	]`)
+
+	tests := []struct {
+		source string
+		user   string
+		want   float64
+	}{
+		{"#other", "someone", 1},
+		{"#sauna", "someone", 5},
+		{"#other", "nick", 3},
+		{"#sauna", "nick", 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source+"/"+tt.user, func(t *testing.T) {
+			got, _ := costsFor(tt.source, tt.user)
+			if got == nil || got.Margin != tt.want {
+				t.Errorf("costsFor() = '%+v', want margin '%v'", got, tt.want)
+			}
+		})
+	}
+
+	// everyone with the same model shares cached results
+	if a, b := costsCacheVary(&lambda.Command{Source: "#other", User: "a"}), costsCacheVary(&lambda.Command{Source: "#other", User: "b"}); a != b {
+		t.Errorf("costsCacheVary() = '%v' and '%v', want equal", a, b)
+	}
+	if a, b := costsCacheVary(&lambda.Command{Source: "#other", User: "a"}), costsCacheVary(&lambda.Command{Source: "#other", User: "nick"}); a == b {
+		t.Errorf("costsCacheVary() = '%v' for both, want different", a)
+	}
+}
+
+func TestParseCosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"valid", `[{"margin": 0.49, "transfer": 4.2, "night_transfer": 2.4, "night_hours": "22-07", "tax": 2.253}]`, false},
+		{"not json", `margin=0.49`, true},
+		{"night without end", `[{"night_hours": "22"}]`, true},
+		{"night out of range", `[{"night_hours": "22-24"}]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validCosts(tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("validCosts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestElectricityWithCosts(t *testing.T) {
+	useFixture(t, entsoeClient, entsoeResponses...)
+	setReplayKey(t, "ENTSOE_API_KEY")
+
+	if *live {
+		t.Skip("compares against the canned prices")
+	}
+
+	timeNow = func() time.Time { return time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+
+	t.Setenv("ELECTRICITY_COSTS", `[{"user": "nick", "margin": 0.5, "transfer": 4, "night_transfer": 2, "night_hours": "22-07", "tax": 2.253}]`)
+
+	tests := []struct {
+		name string
+		user string
+		args string
+		want string
+	}{
+		{"spot only", "someone", "", "Current: 14.36 c/kWh | Lowest: 6.80 c/kWh | Highest: 16.32 c/kWh"},
+		{"current", "nick", "", "Current: 14.36 c/kWh | Lowest: 6.80 c/kWh | Highest: 16.32 c/kWh | With costs now: 22.73 c/kWh"},
+		{"window", "nick", "3h 10kWh", "Cheapest 3h: tomorrow 04:00–07:00, average 5.20 c/kWh, 11.09 c/kWh with costs | 10 kWh ≈ 1.11 €"},
+		{"tomorrow", "nick", "huomenna",
+			"Tomorrow Wed 17.1.: Average: 10.55 c/kWh | Lowest: 4.95 c/kWh @ 05:00 | Highest: 15.20 c/kWh @ 18:00 | Cheapest: 04:00, 05:00, 06:00 | Average with costs: 18.00 c/kWh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ElectricityCommand(context.Background(), &lambda.Command{User: tt.user, Source: "#sauna", Arguments: tt.args})
+			if err != nil {
+				t.Fatalf("ElectricityCommand() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ElectricityCommand() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package command
 
-import "github.com/lepinkainen/lambdabot/lambda"
+import (
+	"context"
+
+	"github.com/lepinkainen/lambdabot/lambda"
+)
 
 // Echo echoes the arguments back
 func Echo(args string) (string, error) {
@@ -9,5 +13,14 @@ func Echo(args string) (string, error) {
 }
 
 func init() {
-	lambda.RegisterHandler("echo", Echo)
+	lambda.Register(lambda.Handler{
+		Name:     "echo",
+		Summary:  "Echo the arguments back",
+		Usage:    "echo <text>",
+		Examples: []string{"echo hello world"},
+		Category: "general",
+		Func: func(_ context.Context, cmd *lambda.Command) (string, error) {
+			return Echo(cmd.Arguments)
+		},
+	})
 }
@@ -0,0 +1,359 @@
+package command
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	// Lambda runtimes don't ship a time zone database
+	_ "time/tzdata"
+
+	"github.com/lepinkainen/lambdabot/lambda"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// publishHour is when the day-ahead prices for the next day are usually out, Helsinki time.
+// The auction results are published at 12:45 CET and reach the transparency platform soon after.
+const publishHour = 14
+
+// helsinki is the time zone of Finnish prices and publishHour
+var helsinki = mustLoadLocation("Europe/Helsinki")
+
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return location
+}
+
+// priceSlot is the spot price of one market time unit in c/kWh, VAT excluded
+type priceSlot struct {
+	Start time.Time
+	End   time.Time
+	Price float64
+}
+
+// contains reports whether t is within the slot
+func (s priceSlot) contains(t time.Time) bool {
+	return !t.Before(s.Start) && t.Before(s.End)
+}
+
+// slotsBetween returns the slots starting in [start, end)
+func slotsBetween(slots []priceSlot, start, end time.Time) []priceSlot {
+	var res []priceSlot
+	for _, slot := range slots {
+		if !slot.Start.Before(start) && slot.Start.Before(end) {
+			res = append(res, slot)
+		}
+	}
+	return res
+}
+
+// hourlyPrices averages slots shorter than an hour to hourly prices, longer slots are kept as they are
+func hourlyPrices(slots []priceSlot) []priceSlot {
+	var hours []priceSlot
+	for _, slot := range slots {
+		length := slot.End.Sub(slot.Start)
+		if length >= time.Hour {
+			hours = append(hours, slot)
+			continue
+		}
+
+		hour := slot.Start.Truncate(time.Hour)
+		if len(hours) == 0 || !hours[len(hours)-1].Start.Equal(hour) {
+			hours = append(hours, priceSlot{Start: hour, End: hour})
+		}
+
+		// weighted by how much of the hour each slot covers
+		last := &hours[len(hours)-1]
+		covered := last.End.Sub(last.Start)
+		last.Price = (last.Price*covered.Hours() + slot.Price*length.Hours()) / (covered + length).Hours()
+		last.End = slot.End
+	}
+	return hours
+}
+
+// sortSlots orders slots by their start time
+func sortSlots(slots []priceSlot) {
+	slices.SortFunc(slots, func(a, b priceSlot) int { return a.Start.Compare(b.Start) })
+}
+
+// priceWindow is a contiguous stretch of time and its time-weighted average price
+type priceWindow struct {
+	Start time.Time
+	End   time.Time
+	Price float64
+}
+
+// averageOver returns the time-weighted average price of [start, end), false if the slots don't cover all of it
+func averageOver(slots []priceSlot, start, end time.Time) (float64, bool) {
+	covered := start
+	var sum float64
+
+	for _, slot := range slots {
+		if !slot.End.After(covered) {
+			continue
+		}
+		if slot.Start.After(covered) || !covered.Before(end) {
+			break
+		}
+		// the first and last slots may only be partially in the range
+		until := slot.End
+		if until.After(end) {
+			until = end
+		}
+		sum += slot.Price * until.Sub(covered).Hours()
+		covered = until
+	}
+
+	if !covered.Equal(end) {
+		return 0, false
+	}
+	return sum / end.Sub(start).Hours(), true
+}
+
+// average returns the time-weighted average price of the slots
+func average(slots []priceSlot) float64 {
+	var sum, hours float64
+	for _, slot := range slots {
+		sum += slot.Price * slot.End.Sub(slot.Start).Hours()
+		hours += slot.End.Sub(slot.Start).Hours()
+	}
+	return sum / hours
+}
+
+// cheapestWindow finds the contiguous window of the given length with the lowest average price.
+// Windows start at a slot boundary, except the earliest one which starts at now in the slot that is running.
+// Returns false if the known prices don't cover any window of that length.
+func cheapestWindow(slots []priceSlot, now time.Time, length time.Duration) (priceWindow, bool) {
+	var (
+		best  priceWindow
+		found bool
+	)
+
+	for _, first := range slots {
+		if !first.End.After(now) {
+			continue
+		}
+
+		// the part of the running slot that has passed can't be used anymore
+		start := first.Start
+		if start.Before(now) {
+			start = now
+		}
+
+		end := start.Add(length)
+		price, ok := averageOver(slots, start, end)
+		if ok && (!found || price < best.Price) {
+			best = priceWindow{Start: start, End: end, Price: price}
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// parseWindowArgs parses a window length like "3h" or "1h30m" and an optional energy like "10kWh" or "7,5"
+func parseWindowArgs(args string) (time.Duration, float64, error) {
+	fields := strings.Fields(args)
+	if len(fields) > 2 {
+		return 0, 0, errors.New("too many arguments")
+	}
+
+	length, err := time.ParseDuration(strings.ToLower(fields[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid duration %q", fields[0])
+	}
+	if length <= 0 || length > 48*time.Hour {
+		return 0, 0, fmt.Errorf("duration must be between 1m and 48h")
+	}
+
+	var energy float64
+	if len(fields) == 2 {
+		value := strings.TrimSuffix(strings.ToLower(fields[1]), "kwh")
+		energy, err = strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		if err != nil || energy <= 0 {
+			return 0, 0, fmt.Errorf("invalid energy %q", fields[1])
+		}
+	}
+
+	return length, energy, nil
+}
+
+// CheapestWindow finds the cheapest time to use electricity for the given duration within the known prices of the zone.
+// With a cost model the window is picked by the total price, time-of-day tariffs can move it.
+// The estimated cost assumes the energy is used evenly over the window.
+func CheapestWindow(ctx context.Context, z zone, costs *costModel, length time.Duration, energy float64) (string, error) {
+	slots, err := knownPrices(ctx, z)
+	if err != nil {
+		return "", err
+	}
+
+	spot := z.withVAT(slots)
+	prices := spot
+	if costs != nil {
+		prices = costs.apply(z, slots)
+	}
+
+	now := timeNow()
+	window, ok := cheapestWindow(prices, now, length)
+	if !ok {
+		if len(slots) == 0 {
+			return z.label() + "No electricity prices available", nil
+		}
+		known := slots[len(slots)-1].End
+		return fmt.Sprintf("%sPrices are known only until %s, not enough for a %s window", z.label(), dayAndTime(known, now, z.Location), formatLength(length)), nil
+	}
+
+	spotPrice, _ := averageOver(spot, window.Start, window.End)
+	res := fmt.Sprintf("%sCheapest %s: %s–%s, average %.2f c/kWh", z.label(), formatLength(length), dayAndTime(window.Start, now, z.Location), window.End.In(z.Location).Format("15:04"), spotPrice)
+	if costs != nil {
+		res += fmt.Sprintf(", %.2f c/kWh with costs", window.Price)
+	}
+	if energy > 0 {
+		res += fmt.Sprintf(" | %s kWh ≈ %.2f €", strconv.FormatFloat(energy, 'f', -1, 64), energy*window.Price/100)
+	}
+	return res, nil
+}
+
+// dayAndTime formats t in the given time zone, prefixed with the day relative to now
+func dayAndTime(t, now time.Time, location *time.Location) string {
+	t, now = t.In(location), now.In(location)
+
+	day := t.Format("Mon")
+	switch {
+	case sameDay(t, now):
+		day = "today"
+	case sameDay(t, now.AddDate(0, 0, 1)):
+		day = "tomorrow"
+	}
+	return day + " " + t.Format("15:04")
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
+
+// formatLength drops the zero minutes and seconds time.Duration prints, 3h0m0s is 3h
+func formatLength(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// TomorrowPrices summarizes tomorrow's prices in the zone: the average, the lowest and highest and the cheapest hours.
+// Before the day-ahead prices are published it tells when they're expected.
+func TomorrowPrices(ctx context.Context, z zone, costs *costModel) (string, error) {
+	slots, err := knownPrices(ctx, z)
+	if err != nil {
+		return "", err
+	}
+
+	now := timeNow().In(z.Location)
+	start := z.dayStart(now).AddDate(0, 0, 1)
+	end := start.AddDate(0, 0, 1)
+	raw := slotsBetween(slots, start, end)
+	tomorrow := z.withVAT(raw)
+
+	// the data may already have the first hours of tomorrow in CET, the whole day is there once published
+	if len(tomorrow) == 0 || tomorrow[len(tomorrow)-1].End.Before(end) {
+		// all zones are published at the same time, shown in the local time of the zone
+		fi := now.In(helsinki)
+		publish := time.Date(fi.Year(), fi.Month(), fi.Day(), publishHour, 0, 0, 0, helsinki)
+		local := publish.In(z.Location).Format("15:04")
+		if now.Before(publish) {
+			return fmt.Sprintf("%sTomorrow's prices are not published yet, expected today around %s", z.label(), local), nil
+		}
+		return fmt.Sprintf("%sTomorrow's prices are not published yet, they're late, usually out by %s", z.label(), local), nil
+	}
+
+	lowest, highest := tomorrow[0], tomorrow[0]
+	for _, slot := range tomorrow {
+		if slot.Price < lowest.Price {
+			lowest = slot
+		}
+		if slot.Price > highest.Price {
+			highest = slot
+		}
+	}
+
+	// the three cheapest hours, shown in time order
+	cheapest := hourlyPrices(tomorrow)
+	slices.SortStableFunc(cheapest, func(a, b priceSlot) int { return cmp.Compare(a.Price, b.Price) })
+	cheapest = cheapest[:min(3, len(cheapest))]
+	sortSlots(cheapest)
+
+	times := make([]string, len(cheapest))
+	for i, slot := range cheapest {
+		times[i] = slot.Start.In(z.Location).Format("15:04")
+	}
+
+	res := fmt.Sprintf("%sTomorrow %s: Average: %.2f c/kWh | Lowest: %.2f c/kWh @ %s | Highest: %.2f c/kWh @ %s | Cheapest: %s",
+		z.label(), start.Format("Mon 2.1."),
+		average(tomorrow),
+		lowest.Price, lowest.Start.In(z.Location).Format("15:04"),
+		highest.Price, highest.Start.In(z.Location).Format("15:04"),
+		strings.Join(times, ", "))
+	if costs != nil {
+		res += fmt.Sprintf(" | Average with costs: %.2f c/kWh", average(costs.apply(z, raw)))
+	}
+	return res, nil
+}
+
+// ComparePrices shows the spot price now and today's average of the zone and its neighbours side by side.
+// VAT differs between countries, so the prices are compared without it.
+func ComparePrices(ctx context.Context, z zone) (string, error) {
+	compared := []zone{z}
+	for _, name := range neighbours[z.Name] {
+		if neighbour, ok := lookupZone(name); ok {
+			compared = append(compared, neighbour)
+		}
+	}
+
+	now := timeNow()
+	results := make([]string, len(compared))
+
+	var wg sync.WaitGroup
+	for i, c := range compared {
+		// a panic in one zone leaves it out instead of failing the whole comparison
+		lambda.Go(ctx, &wg, func() {
+			results[i] = c.Name + " n/a"
+			start := c.dayStart(now)
+			slots, err := zonePrices(ctx, c, start, start.AddDate(0, 0, 1))
+			if err != nil {
+				log.WithContext(ctx).Warnf("Unable to get %s prices: %v", c.Name, err)
+			}
+
+			current, average, ok := currentAndAverage(slots, now)
+			if !ok {
+				return
+			}
+			results[i] = fmt.Sprintf("%s %.2f (%.2f)", c.Name, current, average)
+		})
+	}
+	wg.Wait()
+
+	return "Spot now (today's average) without VAT: " + strings.Join(results, " | ") + " c/kWh", nil
+}
+
+// currentAndAverage returns the price now and the time-weighted average of the slots, false if now isn't covered
+func currentAndAverage(slots []priceSlot, now time.Time) (float64, float64, bool) {
+	for _, slot := range slots {
+		if slot.contains(now) {
+			return slot.Price, average(slots), true
+		}
+	}
+	return 0, 0, false
+}
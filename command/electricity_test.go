@@ -0,0 +1,218 @@
+package command
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheapestWindow(t *testing.T) {
+	useFixture(t, entsoeClient, entsoeResponses...)
+	setReplayKey(t, "ENTSOE_API_KEY")
+
+	if *live {
+		t.Skip("compares against the canned prices")
+	}
+
+	timeNow = func() time.Time { return time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{"hours", "3h", "Cheapest 3h: tomorrow 04:00–07:00, average 5.20 c/kWh"},
+		{"with energy", "3h 10kWh", "Cheapest 3h: tomorrow 04:00–07:00, average 5.20 c/kWh | 10 kWh ≈ 0.52 €"},
+		{"partial hour", "1h30m 7,5", "Cheapest 1h30m: tomorrow 04:00–05:30, average 5.06 c/kWh | 7.5 kWh ≈ 0.38 €"},
+		{"beyond known prices", "40h", "Prices are known only until Thu 00:00, not enough for a 40h window"},
+		{"invalid duration", "sauna", "invalid duration \"sauna\", usage: sahko [zone] [huomenna | vertaa | <duration> [kWh]], e.g. sahko 3h 10kWh"},
+		{"invalid energy", "3h lots", "invalid energy \"lots\", usage: sahko [zone] [huomenna | vertaa | <duration> [kWh]], e.g. sahko 3h 10kWh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := electricity(context.Background(), tt.args, nil)
+			if err != nil {
+				t.Fatalf("electricity() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("electricity() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheapestWindowGap(t *testing.T) {
+	start := time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)
+	slot := func(hour int, price float64) priceSlot {
+		s := start.Add(time.Duration(hour) * time.Hour)
+		return priceSlot{Start: s, End: s.Add(time.Hour), Price: price}
+	}
+
+	// the two cheap hours aren't contiguous, so the window has to settle for the expensive pair
+	slots := []priceSlot{slot(0, 1), slot(1, 10), slot(2, 10), slot(4, 1)}
+
+	got, ok := cheapestWindow(slots, start, 2*time.Hour)
+	if !ok {
+		t.Fatalf("cheapestWindow() found no window")
+	}
+	if !got.Start.Equal(start) || got.Price != 5.5 {
+		t.Errorf("cheapestWindow() = '%v', want '%v'", got, priceWindow{Start: start, End: start.Add(2 * time.Hour), Price: 5.5})
+	}
+}
+
+func TestCheapestWindowNowInSlot(t *testing.T) {
+	start := time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)
+	slot := func(hour int, price float64) priceSlot {
+		s := start.Add(time.Duration(hour) * time.Hour)
+		return priceSlot{Start: s, End: s.Add(time.Hour), Price: price}
+	}
+
+	// the cheap hour is half over, the window starts now instead of at its start
+	slots := []priceSlot{slot(0, 1), slot(1, 10), slot(2, 10)}
+	now := start.Add(30 * time.Minute)
+
+	got, ok := cheapestWindow(slots, now, time.Hour)
+	want := priceWindow{Start: now, End: now.Add(time.Hour), Price: 5.5}
+	if !ok || got != want {
+		t.Errorf("cheapestWindow() = '%v', want '%v'", got, want)
+	}
+}
+
+func TestTomorrowPrices(t *testing.T) {
+	useFixture(t, entsoeClient, entsoeResponses...)
+	setReplayKey(t, "ENTSOE_API_KEY")
+
+	if *live {
+		t.Skip("compares against the canned prices")
+	}
+	defer func() { timeNow = time.Now }()
+
+	tests := []struct {
+		name string
+		now  time.Time
+		args string
+		want string
+	}{
+		{"published", time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC), "huomenna",
+			"Tomorrow Wed 17.1.: Average: 10.55 c/kWh | Lowest: 4.95 c/kWh @ 05:00 | Highest: 15.20 c/kWh @ 18:00 | Cheapest: 04:00, 05:00, 06:00"},
+		{"english", time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC), "Tomorrow",
+			"Tomorrow Wed 17.1.: Average: 10.55 c/kWh | Lowest: 4.95 c/kWh @ 05:00 | Highest: 15.20 c/kWh @ 18:00 | Cheapest: 04:00, 05:00, 06:00"},
+		{"not yet published", time.Date(2024, 1, 17, 10, 30, 0, 0, time.UTC), "huomenna",
+			"Tomorrow's prices are not published yet, expected today around 14:00"},
+		{"late", time.Date(2024, 1, 17, 13, 30, 0, 0, time.UTC), "huomenna",
+			"Tomorrow's prices are not published yet, they're late, usually out by 14:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timeNow = func() time.Time { return tt.now }
+
+			got, err := electricity(context.Background(), tt.args, nil)
+			if err != nil {
+				t.Fatalf("electricity() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("electricity() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHourlyPrices(t *testing.T) {
+	start := time.Date(2025, 10, 2, 0, 0, 0, 0, time.UTC)
+	slot := func(minutes, length int, price float64) priceSlot {
+		s := start.Add(time.Duration(minutes) * time.Minute)
+		return priceSlot{Start: s, End: s.Add(time.Duration(length) * time.Minute), Price: price}
+	}
+
+	slots := []priceSlot{slot(0, 15, 1), slot(15, 15, 2), slot(30, 15, 3), slot(45, 15, 6), slot(60, 60, 5)}
+	want := []priceSlot{slot(0, 60, 3), slot(60, 60, 5)}
+
+	got := hourlyPrices(slots)
+	if len(got) != len(want) {
+		t.Fatalf("hourlyPrices() = '%v', want '%v'", got, want)
+	}
+	for i := range want {
+		if !got[i].Start.Equal(want[i].Start) || !got[i].End.Equal(want[i].End) || got[i].Price != want[i].Price {
+			t.Errorf("hourlyPrices()[%d] = '%v', want '%v'", i, got[i], want[i])
+		}
+	}
+}
+
+func TestZonePrices(t *testing.T) {
+	useFixture(t, entsoeClient, entsoeResponses...)
+	setReplayKey(t, "ENTSOE_API_KEY")
+
+	if *live {
+		t.Skip("compares against the canned prices")
+	}
+
+	timeNow = func() time.Time { return time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{"finland", "FI", "Current: 14.36 c/kWh | Lowest: 6.80 c/kWh | Highest: 16.32 c/kWh"},
+		{"other zone", "se3", "SE3: Current: 8.69 c/kWh | Lowest: 4.12 c/kWh | Highest: 9.87 c/kWh"},
+		{"without VAT", "NO4", "NO4: Current: 3.47 c/kWh | Lowest: 1.65 c/kWh | Highest: 3.95 c/kWh"},
+		{"compare", "vertaa", "Spot now (today's average) without VAT: FI 11.58 (9.39) | SE1 4.05 (3.25) | SE3 6.95 (5.57) | EE 12.16 (9.86) | NO4 3.47 (2.79) c/kWh"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := electricity(context.Background(), tt.args, nil)
+			if err != nil {
+				t.Fatalf("electricity() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("electricity() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZonePricesRedis(t *testing.T) {
+	t.Setenv("REDIS_ADDR", "localhost:6379")
+	setReplayKey(t, "ENTSOE_API_KEY")
+	if *live {
+		t.Skip("compares against the canned prices")
+	}
+
+	timeNow = func() time.Time { return time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+
+	// the cron has stored all of today but none of tomorrow
+	today := finland.dayStart(timeNow())
+	storedPrices = func(_ context.Context, _ zone, start, end time.Time) ([]priceSlot, error) {
+		var slots []priceSlot
+		for hour := today; hour.Before(today.AddDate(0, 0, 1)); hour = hour.Add(time.Hour) {
+			if !hour.Before(start) && hour.Before(end) {
+				slots = append(slots, priceSlot{Start: hour, End: hour.Add(time.Hour), Price: 10})
+			}
+		}
+		return slots, nil
+	}
+	defer func() { storedPrices = redisPrices }()
+
+	t.Run("stored", func(t *testing.T) {
+		// nothing is fetched from the API when Redis has the whole range
+		useFixture(t, entsoeClient)
+
+		got, err := electricity(context.Background(), "", nil)
+		if want := "Current: 12.40 c/kWh | Lowest: 12.40 c/kWh | Highest: 12.40 c/kWh"; err != nil || got != want {
+			t.Errorf("electricity() = '%v', %v, want '%v'", got, err, want)
+		}
+	})
+
+	t.Run("tomorrow missing", func(t *testing.T) {
+		useFixture(t, entsoeClient, entsoeResponses...)
+
+		got, err := electricity(context.Background(), "huomenna", nil)
+		want := "Tomorrow Wed 17.1.: Average: 10.55 c/kWh | Lowest: 4.95 c/kWh @ 05:00 | Highest: 15.20 c/kWh @ 18:00 | Cheapest: 04:00, 05:00, 06:00"
+		if err != nil || got != want {
+			t.Errorf("electricity() = '%v', %v, want '%v'", got, err, want)
+		}
+	})
+}
@@ -4,16 +4,30 @@ import (
 	"context"
 	"encoding/xml"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/redis/go-redis/v9"
-
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/httpclient"
 	"github.com/lepinkainen/lambdabot/lambda"
+
+	log "github.com/sirupsen/logrus"
 )
 
+// entsoeClient calls the ENTSO-E transparency platform API
+var entsoeClient = httpclient.New(httpclient.Config{
+	Name:    "entsoe",
+	BaseURL: "https://web-api.tp.entsoe.eu",
+	Timeout: 10 * time.Second,
+})
+
+// timeNow is replaceable so tests can use prices of a fixed day
+var timeNow = time.Now
+
 type PublicationMarketDocument struct {
 	XMLName                   xml.Name          `xml:"Publication_MarketDocument"`
 	MRID                      string            `xml:"mRID"`
@@ -50,14 +64,17 @@ type TimeSeries struct {
 		CodingScheme string `xml:"codingScheme,attr"`
 		MRID         string `xml:",chardata"`
 	} `xml:"out_Domain.mRID"`
-	CurrencyUnitName     string `xml:"currency_Unit.name"`
-	PriceMeasureUnitName string `xml:"price_Measure_Unit.name"`
-	CurveType            string `xml:"curveType"`
-	Period               struct {
-		TimeInterval TimeInterval `xml:"timeInterval"`
-		Resolution   string       `xml:"resolution"`
-		Points       []Point      `xml:"Point"`
-	} `xml:"Period"`
+	CurrencyUnitName     string   `xml:"currency_Unit.name"`
+	PriceMeasureUnitName string   `xml:"price_Measure_Unit.name"`
+	CurveType            string   `xml:"curveType"`
+	Periods              []Period `xml:"Period"`
+}
+
+// Period is a run of prices at a fixed resolution, a time series can have several with gaps between them
+type Period struct {
+	TimeInterval TimeInterval `xml:"timeInterval"`
+	Resolution   string       `xml:"resolution"`
+	Points       []Point      `xml:"Point"`
 }
 
 type Point struct {
@@ -65,184 +82,342 @@ type Point struct {
 	PriceAmount float64 `xml:"price.amount"`
 }
 
+// AcknowledgementMarketDocument is returned instead of prices when the API can't answer the query
+type AcknowledgementMarketDocument struct {
+	XMLName xml.Name `xml:"Acknowledgement_MarketDocument"`
+	Reasons []Reason `xml:"Reason"`
+}
+
+type Reason struct {
+	Code string `xml:"code"`
+	Text string `xml:"text"`
+}
+
+// noData reports whether the query was fine but there are no prices for the period, e.g. tomorrow before they're published
+func (d *AcknowledgementMarketDocument) noData() bool {
+	for _, reason := range d.Reasons {
+		if strings.HasPrefix(reason.Text, "No matching data found") {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *AcknowledgementMarketDocument) String() string {
+	texts := make([]string, len(d.Reasons))
+	for i, reason := range d.Reasons {
+		texts[i] = reason.Code + " " + reason.Text
+	}
+	return strings.Join(texts, ", ")
+}
+
 type PricePoint struct {
 	Time  string
 	Price float64
 }
 
-// GetPriceString retrieves the current, lowest, and highest prices in c/kWh from the entso-e API.
-//
-// It does this by making an HTTP request to the API, parsing the XML response, and calculating the prices.
-// The API key is retrieved from the environment variable "ENTSOE_API_KEY".
-//
-// Return:
-//   - A string containing the current, lowest, and highest prices in the format "Current: {currentPrice} c/kWh | Lowest: {lowestPrice} c/kWh | Highest: {highestPrice} c/kWh".
-//   - An error if there is an issue making the HTTP request, reading the HTTP response,
-//     unmarshaling the XML, or any other error that occurs during the process.
-func GetPriceString() (string, error) {
+// entsoeDomain is the EIC code of the Finnish bidding zone
+const entsoeDomain = "10YFI-1--------U"
 
-	now := time.Now()
+// curveSequential is the A03 curve type, where points repeating the previous price are left out
+const curveSequential = "A03"
 
-	apikey := os.Getenv("ENTSOE_API_KEY")
+// resolutionPattern matches the ISO-8601 durations used as period resolutions, e.g. PT60M, PT15M or P1D
+var resolutionPattern = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
 
-	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).Format("200601020000")
-	end := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location()).Format("200601020000")
+// parseResolution converts an ISO-8601 duration to a time.Duration.
+// Years and months have no fixed length and aren't used for prices, so they're rejected.
+func parseResolution(value string) (time.Duration, error) {
+	match := resolutionPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("unsupported resolution %q", value)
+	}
 
-	url := fmt.Sprintf("https://web-api.tp.entsoe.eu/api?securityToken=%s&documentType=A44&out_Domain=10YFI-1--------U&in_Domain=10YFI-1--------U&periodStart=%s&periodEnd=%s", apikey, start, end)
+	var d time.Duration
+	for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if match[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("unsupported resolution %q", value)
+		}
+		d += time.Duration(n) * unit
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("unsupported resolution %q", value)
+	}
+	return d, nil
+}
 
-	resp, err := http.Get(url)
+// parseEntsoeTime parses the UTC timestamps of time intervals, with or without seconds
+func parseEntsoeTime(value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02T15:04Z", value)
 	if err != nil {
-		return "Error making HTTP request", err
+		return time.Parse(time.RFC3339, value)
 	}
-	defer resp.Body.Close()
+	return t, nil
+}
 
-	xmlData, err := io.ReadAll(resp.Body)
+// slots returns the prices of the period in c/kWh.
+// Points of A03 curves last until the next point or the end of the period.
+func (p Period) slots(curveType string) ([]priceSlot, error) {
+	start, err := parseEntsoeTime(p.TimeInterval.Start)
 	if err != nil {
-		return "Error reading HTTP response", err
+		return nil, fmt.Errorf("parsing period start: %w", err)
 	}
-
-	var doc PublicationMarketDocument
-	err = xml.Unmarshal(xmlData, &doc)
+	end, err := parseEntsoeTime(p.TimeInterval.End)
 	if err != nil {
-		return "Error unmarshaling XML", err
+		return nil, fmt.Errorf("parsing period end: %w", err)
+	}
+	resolution, err := parseResolution(p.Resolution)
+	if err != nil {
+		return nil, err
 	}
 
-	var lowestPrice = PricePoint{Price: 999999999.0}
-	var highestPrice = PricePoint{Price: -999999999.0}
-	var currentPrice PricePoint
+	// positions start from 1
+	positions := int(end.Sub(start) / resolution)
+	slot := func(position int, amount float64) priceSlot {
+		slotStart := start.Add(time.Duration(position-1) * resolution)
+		// EUR/MWh to c/kWh
+		return priceSlot{Start: slotStart, End: slotStart.Add(resolution), Price: amount / 10}
+	}
 
-	layout := "2006-01-02T15:04Z"
+	points := slices.Clone(p.Points)
+	slices.SortFunc(points, func(a, b Point) int { return a.Position - b.Position })
 
-	for _, timeserie := range doc.TimeSeries {
-		// start of this timeseries
-		startStr := timeserie.Period.TimeInterval.Start
-		start, _ := time.Parse(layout, startStr)
+	var slots []priceSlot
+	for i, point := range points {
+		if point.Position < 1 || point.Position > positions {
+			continue
+		}
 
-		for _, point := range timeserie.Period.Points {
+		next := point.Position + 1
+		if curveType == curveSequential {
+			next = positions + 1
+			if i+1 < len(points) {
+				next = min(points[i+1].Position, next)
+			}
+		}
 
-			// the actual time of the point
-			pointTime := start.Add(time.Duration(point.Position-1) * time.Hour)
+		for position := point.Position; position < next; position++ {
+			slots = append(slots, slot(position, point.PriceAmount))
+		}
+	}
+	return slots, nil
+}
 
-			// timestamp and actual c/kWh price (VAT included)
-			pricePoint := PricePoint{
-				Time:  pointTime.Format(layout),
-				Price: point.PriceAmount / 10 * 1.24,
+// parsePrices returns the prices of a publication document between start and end, ordered by time.
+// Overlapping periods are resolved in favor of the first one in the document.
+func parsePrices(doc *PublicationMarketDocument, start, end time.Time) ([]priceSlot, error) {
+	var slots []priceSlot
+	for _, timeserie := range doc.TimeSeries {
+		for _, period := range timeserie.Periods {
+			periodSlots, err := period.slots(timeserie.CurveType)
+			if err != nil {
+				return nil, err
 			}
+			slots = append(slots, slotsBetween(periodSlots, start, end)...)
+		}
+	}
 
-			// price at point is lower than lowest, set to lowest
-			if point.PriceAmount < lowestPrice.Price {
-				lowestPrice = pricePoint
-			}
+	slices.SortStableFunc(slots, func(a, b priceSlot) int { return a.Start.Compare(b.Start) })
+	return slices.CompactFunc(slots, func(a, b priceSlot) bool { return a.Start.Equal(b.Start) }), nil
+}
 
-			// price at point is higher than highest, set to highest
-			if point.PriceAmount > highestPrice.Price {
-				highestPrice = pricePoint
-			}
+// entsoePrices fetches the day-ahead prices of the zone between start and end from the entso-e API.
+// The API key is retrieved from the environment variable "ENTSOE_API_KEY".
+func entsoePrices(ctx context.Context, z zone, start, end time.Time) ([]priceSlot, error) {
+	query := url.Values{
+		"securityToken": {config.Get("ENTSOE_API_KEY")},
+		"documentType":  {"A44"},
+		"out_Domain":    {z.EIC},
+		"in_Domain":     {z.EIC},
+		// the API takes UTC times
+		"periodStart": {start.UTC().Format("200601021504")},
+		"periodEnd":   {end.UTC().Format("200601021504")},
+	}
 
-			// Check if the pointTime matches the current time, without the minute and second
-			now := time.Now().Truncate(time.Hour)
-			if pointTime.Equal(now) {
-				currentPrice = pricePoint
-			}
+	resp, err := entsoeClient.Get(ctx, "/api", query)
+	if err != nil {
+		return nil, fmt.Errorf("making HTTP request: %w", err)
+	}
+
+	// errors and empty results come as acknowledgements with the reason
+	var ack AcknowledgementMarketDocument
+	if xml.Unmarshal(resp.Body, &ack) == nil {
+		if resp.OK() && ack.noData() {
+			return nil, nil
 		}
+		return nil, fmt.Errorf("entso-e API returned status %d: %s", resp.StatusCode, ack.String())
+	}
+	if !resp.OK() {
+		return nil, fmt.Errorf("entso-e API returned status %d", resp.StatusCode)
 	}
 
-	return fmt.Sprintf("Current: %.2f c/kWh | Lowest: %.2f c/kWh | Highest: %.2f c/kWh", currentPrice.Price, lowestPrice.Price, highestPrice.Price), nil
-}
+	var doc PublicationMarketDocument
+	if err := xml.Unmarshal(resp.Body, &doc); err != nil {
+		return nil, fmt.Errorf("unmarshaling XML: %w", err)
+	}
 
-// Echo echoes the arguments back
-func Entsoe(_ string) (string, error) {
-	return GetPriceString()
+	return parsePrices(&doc, start, end)
 }
 
-var ctx = context.Background()
-
-const DBNAME = "entsoe:fi"
-
-// EntsoeRedis retrieves current, lowest, and highest prices from Redis timeseries
-//
-// # A separate system is ran in cron to update the timeseries data from entso-e
-//
-// args: A string representing the arguments for the Redis client.
-// Returns: A string containing the formatted current, lowest, and highest prices in c/kWh, and an error if any.
-func EntsoeRedis(_ string) (string, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     os.Getenv("REDIS_ADDR"),
-		Username: "default",
-		Password: os.Getenv("REDIS_PASSWORD"),
-		DB:       0, // use default DB
-	})
+// currentPrices formats the price now and the lowest and highest price of the slots
+func currentPrices(slots []priceSlot, now time.Time) string {
+	var lowestPrice = PricePoint{Price: 999999999.0}
+	var highestPrice = PricePoint{Price: -999999999.0}
+	var currentPrice PricePoint
 
-	res := rdb.Ping(ctx)
-	if res.Err() != nil {
-		return "", res.Err()
+	for _, slot := range slots {
+		// timestamp and actual c/kWh price (VAT included)
+		pricePoint := PricePoint{
+			Time:  slot.Start.UTC().Format("2006-01-02T15:04Z"),
+			Price: slot.Price,
+		}
+
+		// price at point is lower than lowest, set to lowest
+		if pricePoint.Price < lowestPrice.Price {
+			lowestPrice = pricePoint
+		}
+
+		// price at point is higher than highest, set to highest
+		if pricePoint.Price > highestPrice.Price {
+			highestPrice = pricePoint
+		}
+
+		if slot.contains(now) {
+			currentPrice = pricePoint
+		}
 	}
 
-	var currentPrice = 999999999.0
-	var dayLow = 999999999.0
-	var dayHigh = -999999999.0
+	return fmt.Sprintf("Current: %.2f c/kWh | Lowest: %.2f c/kWh | Highest: %.2f c/kWh", currentPrice.Price, lowestPrice.Price, highestPrice.Price)
+}
+
+// ElectricityCommand runs sahko with the cost model of the user and source of the command
+func ElectricityCommand(ctx context.Context, cmd *lambda.Command) (string, error) {
+	costs, _ := costsFor(cmd.Source, cmd.User)
+	return electricity(ctx, cmd.Arguments, costs)
+}
+
+// electricity returns prices of a zone, Finland unless the first argument names another one.
+// With "huomenna" it summarizes tomorrow, with "vertaa" it compares the zone to its neighbours
+// and with a duration it finds the cheapest window of that length.
+func electricity(ctx context.Context, args string, costs *costModel) (string, error) {
+	fields := strings.Fields(args)
 
-	// This time we want times specifically in the Finnish time zone
-	location, _ := time.LoadLocation("Europe/Helsinki")
+	z := finland
+	if len(fields) > 0 {
+		if found, ok := lookupZone(fields[0]); ok {
+			z, fields = found, fields[1:]
+		}
+	}
 
-	// current time to 1hr accuracy
-	now := time.Now().In(location).Truncate(time.Hour)
-	nowUnix := int(now.UnixMilli()) // redis likes unix milliseconds
+	switch arg := strings.ToLower(strings.Join(fields, " ")); arg {
+	case "":
+		return CurrentPrices(ctx, z, costs)
+	case "huomenna", "tomorrow":
+		return TomorrowPrices(ctx, z, costs)
+	case "vertaa", "compare":
+		return ComparePrices(ctx, z)
+	default:
+		duration, energy, err := parseWindowArgs(arg)
+		if err != nil {
+			return fmt.Sprintf("%v, usage: sahko [zone] [huomenna | vertaa | <duration> [kWh]], e.g. sahko 3h 10kWh", err), nil
+		}
+		return CheapestWindow(ctx, z, costs, duration, energy)
+	}
+}
 
-	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
-	endOfDay := startOfDay.Add(23 * time.Hour).Add(59 * time.Minute).Add(59 * time.Second) // just before midnight
+// CurrentPrices returns the current, lowest and highest price of today in the zone.
+// With a cost model it adds what the electricity costs now with the margin, transfer and tax.
+func CurrentPrices(ctx context.Context, z zone, costs *costModel) (string, error) {
+	now := timeNow()
+	start := z.dayStart(now)
 
-	// day max
-	// ts.range entsoe:fi 1705356000000 1705442400000 AGGREGATION max 3600000000
-	// day min
-	// ts.range entsoe:fi 1705356000000 1705442400000 AGGREGATION min 3600000000
-	// NOTE: subtract 100000 from end time to get only 24 hours, otherwise you'll get 25 hours and bad data
+	slots, err := zonePrices(ctx, z, start, start.AddDate(0, 0, 1))
+	if err != nil {
+		return "", err
+	}
+	if len(slots) == 0 {
+		return z.label() + "No electricity prices available", nil
+	}
 
-	// grab value for the current time from redis
-	valueSlice := rdb.TSRange(ctx, DBNAME, nowUnix, nowUnix)
-	if valueSlice.Err() != nil {
-		fmt.Printf("Error getting values from Redis: %+v\n", valueSlice.Err())
-		return "", valueSlice.Err()
+	res := z.label() + currentPrices(z.withVAT(slots), now)
+	if costs != nil {
+		if total, _, ok := currentAndAverage(costs.apply(z, slots), now); ok {
+			res += fmt.Sprintf(" | With costs now: %.2f c/kWh", total)
+		}
 	}
-	tsValue, _ := valueSlice.Result()
-	if len(tsValue) > 0 {
-		currentPrice = tsValue[0].Value
+	return res, nil
+}
+
+// storedPrices reads prices from Redis, replaceable so tests don't need a Redis with timeseries
+var storedPrices = redisPrices
+
+// zonePrices returns prices from the Redis timeseries when it's configured and has all of [start, end),
+// otherwise from the entso-e API. The cron filling Redis can lag behind, e.g. tomorrow is published
+// but only today is stored. Redis prices are still used if the API fails or has nothing more.
+func zonePrices(ctx context.Context, z zone, start, end time.Time) ([]priceSlot, error) {
+	var stored []priceSlot
+	if config.IsSet("REDIS_ADDR") {
+		slots, err := storedPrices(ctx, z, start, end)
+		if err != nil {
+			log.WithContext(ctx).Warnf("Unable to get %s prices from Redis, falling back to entso-e API: %v", z.Name, err)
+		} else if _, covered := averageOver(slots, start, end); covered {
+			return slots, nil
+		}
+		stored = slots
 	}
 
-	// Grab maximum from redis
-	valueSlice = rdb.TSRangeWithArgs(ctx, DBNAME, int(startOfDay.UnixMilli()), int(endOfDay.UnixMilli()), &redis.TSRangeOptions{
-		Aggregator:     redis.Max,
-		BucketDuration: 3600000000,
-	})
-	if valueSlice.Err() != nil {
-		fmt.Printf("Error getting values from Redis: %+v\n", valueSlice.Err())
-		return "", valueSlice.Err()
+	slots, err := entsoePrices(ctx, z, start, end)
+	if err != nil {
+		if len(stored) > 0 {
+			log.WithContext(ctx).Warnf("Unable to get %s prices from entso-e API, using the ones in Redis: %v", z.Name, err)
+			return stored, nil
+		}
+		return nil, err
 	}
-	tsValue, _ = valueSlice.Result()
-	if len(tsValue) > 0 {
-		dayHigh = tsValue[0].Value
+	if len(slots) < len(stored) {
+		return stored, nil
 	}
+	return slots, nil
+}
 
-	// Grab minimum from redis
-	valueSlice = rdb.TSRangeWithArgs(ctx, DBNAME, int(startOfDay.UnixMilli()), int(endOfDay.UnixMilli()), &redis.TSRangeOptions{
-		Aggregator:     redis.Min,
-		BucketDuration: 3600000000,
-	})
-	if valueSlice.Err() != nil {
-		fmt.Printf("Error getting values from Redis: %+v\n", valueSlice.Err())
-		return "", valueSlice.Err()
+// knownPrices returns the prices of the zone from the start of today until the end of tomorrow,
+// tomorrow is missing until the day-ahead auction results are published
+func knownPrices(ctx context.Context, z zone) ([]priceSlot, error) {
+	start := z.dayStart(timeNow())
+	return zonePrices(ctx, z, start, start.AddDate(0, 0, 2))
+}
+
+// redisPrices reads the prices of the zone between start and end from the Redis timeseries
+func redisPrices(ctx context.Context, z zone, start, end time.Time) ([]priceSlot, error) {
+	rdb := lambda.RedisClient()
+	if rdb == nil {
+		return nil, fmt.Errorf("REDIS_ADDR not set")
 	}
-	tsValue, _ = valueSlice.Result()
-	if len(tsValue) > 0 {
-		dayLow = tsValue[0].Value
+
+	// the end is exclusive, the timeseries range isn't
+	values, err := rdb.TSRange(ctx, z.redisKey(), int(start.UnixMilli()), int(end.UnixMilli())-1).Result()
+	if err != nil {
+		return nil, err
 	}
 
-	// TODO: dayLow and dayHigh are not working properly
-	//  Current: 11.86 c/kWh | Lowes @ 08: 10.18 c/kWh | Highest @ 08: 18.60 c/kWh
-	//
-	// Should be a range like 07-08 and 15-16
+	// the timeseries only has start times, every point lasts as long as the shortest gap between them
+	resolution := time.Hour
+	for i := 1; i < len(values); i++ {
+		if gap := time.Duration(values[i].Timestamp-values[i-1].Timestamp) * time.Millisecond; gap > 0 && gap < resolution {
+			resolution = gap
+		}
+	}
 
-	return fmt.Sprintf("Current: %.2f c/kWh | Lowest: %.2f c/kWh | Highest: %.2f c/kWh", currentPrice*1.24, dayLow*1.24, dayHigh*1.24), nil
+	slots := make([]priceSlot, 0, len(values))
+	for _, value := range values {
+		slotStart := time.UnixMilli(value.Timestamp)
+		slots = append(slots, priceSlot{Start: slotStart, End: slotStart.Add(resolution), Price: value.Value})
+	}
+	return slots, nil
 }
 
 /*
@@ -261,6 +436,21 @@ func unixToHourString(unix int64) string {
 */
 
 func init() {
-	lambda.RegisterHandler("sahko", EntsoeRedis)
-	lambda.RegisterHandler("sahko2", Entsoe)
+	config.Register(config.Setting{Key: "ENTSOE_API_KEY", Description: "ENTSO-E transparency platform token for sahko", Secret: true})
+
+	lambda.Register(lambda.Handler{
+		Name:     "sahko",
+		Aliases:  []string{"sahko2"},
+		Summary:  "Spot electricity prices in Finland and nearby zones and the cheapest time to use it",
+		Usage:    "sahko [zone] [huomenna | vertaa | <duration> [kWh]]",
+		Examples: []string{"sahko", "sahko huomenna", "sahko 3h", "sahko 2h30m 10kWh", "sahko se3", "sahko vertaa"},
+		Category: "prices",
+		// the market time unit is 15 minutes, the price can change at every quarter hour
+		CacheTTL: lambda.UntilNext(15 * time.Minute),
+		// users and sources can have their own cost models
+		CacheVary: costsCacheVary,
+		// prices come from Redis when it's there, the API works without it
+		Requires: []string{"REDIS_ADDR|ENTSOE_API_KEY"},
+		Func:     ElectricityCommand,
+	})
 }
@@ -0,0 +1,245 @@
+package command
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Made-up day-ahead prices in €/MWh, hourly for the CET days of 16.1. and 17.1.2024.
+// The other zones follow the shape of the Finnish prices at their own levels.
+var (
+	pricesFI16  = []float64{62.15, 58.40, 55.02, 54.87, 56.31, 61.90, 78.44, 96.12, 110.53, 118.27, 121.06, 115.80, 108.64, 104.22, 101.37, 107.95, 119.48, 131.62, 126.09, 112.75, 98.30, 86.41, 74.93, 68.20}
+	pricesFI17  = []float64{71.02, 64.55, 48.10, 41.27, 39.88, 44.63, 67.91, 92.40, 104.18, 109.75, 106.32, 99.84, 95.17, 93.06, 96.41, 103.29, 114.86, 122.57, 117.30, 101.68, 88.24, 79.53, 72.16, 66.80}
+	pricesSE116 = []float64{21.75, 20.44, 19.26, 19.20, 19.71, 21.66, 27.45, 33.64, 38.69, 41.39, 42.37, 40.53, 38.02, 36.48, 35.48, 37.78, 41.82, 46.07, 44.13, 39.46, 34.40, 30.24, 26.23, 23.87}
+	pricesSE316 = []float64{37.29, 35.04, 33.01, 32.92, 33.79, 37.14, 47.06, 57.67, 66.32, 70.96, 72.64, 69.48, 65.18, 62.53, 60.82, 64.77, 71.69, 78.97, 75.65, 67.65, 58.98, 51.85, 44.96, 40.92}
+	pricesEE16  = []float64{65.26, 61.32, 57.77, 57.61, 59.13, 65.00, 82.36, 100.93, 116.06, 124.18, 127.11, 121.59, 114.07, 109.43, 106.44, 113.35, 125.45, 138.20, 132.39, 118.39, 103.22, 90.73, 78.68, 71.61}
+	pricesNO416 = []float64{18.64, 17.52, 16.51, 16.46, 16.89, 18.57, 23.53, 28.84, 33.16, 35.48, 36.32, 34.74, 32.59, 31.27, 30.41, 32.38, 35.84, 39.49, 37.83, 33.82, 29.49, 25.92, 22.48, 20.46}
+)
+
+// entsoeResponses answers the price queries of the sahko tests at 16.1.2024 10:30 UTC
+var entsoeResponses = []response{
+	// today, today and tomorrow and tomorrow in Finland
+	entsoeResponse(finland.EIC, "202401152200", "202401162200", pricesFI16),
+	entsoeResponse(finland.EIC, "202401152200", "202401172200", pricesFI16, pricesFI17),
+	entsoeResponse(finland.EIC, "202401162200", "202401182200", pricesFI17),
+	// today in the other zones, days start at their local midnight
+	entsoeResponse("10Y1001A1001A44P", "202401152300", "202401162300", pricesSE116),
+	entsoeResponse("10Y1001A1001A46L", "202401152300", "202401162300", pricesSE316),
+	entsoeResponse("10Y1001A1001A39I", "202401152200", "202401162200", pricesEE16),
+	entsoeResponse("10YNO-4--------1", "202401152300", "202401162300", pricesNO416),
+}
+
+// entsoeResponse is the price document for the query of the zone, one hourly period for each CET day of prices.
+// The periods start at the CET midnight of periodStart's date, 23:00 UTC in winter.
+func entsoeResponse(eic, periodStart, periodEnd string, days ...[]float64) response {
+	query := url.Values{
+		"documentType": {"A44"},
+		"in_Domain":    {eic},
+		"out_Domain":   {eic},
+		"periodStart":  {periodStart},
+		"periodEnd":    {periodEnd},
+	}
+
+	first, err := time.Parse("200601021504", periodStart)
+	if err != nil {
+		panic(err)
+	}
+	start := time.Date(first.Year(), first.Month(), first.Day(), 23, 0, 0, 0, time.UTC)
+
+	doc := PublicationMarketDocument{Type: "A44"}
+	for i, prices := range days {
+		dayStart := start.AddDate(0, 0, i)
+		period := Period{
+			TimeInterval: TimeInterval{
+				Start: dayStart.Format("2006-01-02T15:04Z"),
+				End:   dayStart.Add(time.Duration(len(prices)) * time.Hour).Format("2006-01-02T15:04Z"),
+			},
+			Resolution: "PT60M",
+		}
+		for position, price := range prices {
+			period.Points = append(period.Points, Point{Position: position + 1, PriceAmount: price})
+		}
+		doc.TimeSeries = append(doc.TimeSeries, TimeSeries{CurrencyUnitName: "EUR", PriceMeasureUnitName: "MWH", CurveType: "A01", Periods: []Period{period}})
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return response{Path: "/api", Query: query.Encode(), Status: http.StatusOK, ContentType: "text/xml", Body: xml.Header + string(body)}
+}
+
+func TestCurrentPrices(t *testing.T) {
+	useFixture(t, entsoeClient, entsoeResponses...)
+	setReplayKey(t, "ENTSOE_API_KEY")
+
+	if !*live {
+		timeNow = func() time.Time { return time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC) }
+		defer func() { timeNow = time.Now }()
+	}
+
+	got, err := CurrentPrices(context.Background(), finland, nil)
+	if err != nil {
+		t.Fatalf("CurrentPrices() error = %v", err)
+	}
+
+	if *live {
+		return
+	}
+
+	want := "Current: 14.36 c/kWh | Lowest: 6.80 c/kWh | Highest: 16.32 c/kWh"
+	if got != want {
+		t.Errorf("CurrentPrices() = '%v', want '%v'", got, want)
+	}
+}
+
+func TestParseResolution(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"PT60M", time.Hour, false},
+		{"PT15M", 15 * time.Minute, false},
+		{"PT1H", time.Hour, false},
+		{"P1D", 24 * time.Hour, false},
+		{"PT1H30M", 90 * time.Minute, false},
+		{"P1M", 0, true},
+		{"PT0M", 0, true},
+		{"60", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseResolution(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResolution() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseResolution() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePrices(t *testing.T) {
+	// two A03 periods at 15 minute resolution with a gap between them, repeated prices are left out
+	const document = `<Publication_MarketDocument>
+  <TimeSeries>
+    <curveType>A03</curveType>
+    <Period>
+      <timeInterval><start>2025-10-01T22:00Z</start><end>2025-10-01T23:00Z</end></timeInterval>
+      <resolution>PT15M</resolution>
+      <Point><position>1</position><price.amount>40</price.amount></Point>
+      <Point><position>3</position><price.amount>20</price.amount></Point>
+    </Period>
+    <Period>
+      <timeInterval><start>2025-10-02T00:00Z</start><end>2025-10-02T00:30Z</end></timeInterval>
+      <resolution>PT15M</resolution>
+      <Point><position>2</position><price.amount>10</price.amount></Point>
+      <Point><position>1</position><price.amount>30</price.amount></Point>
+    </Period>
+  </TimeSeries>
+  <TimeSeries>
+    <curveType>A01</curveType>
+    <Period>
+      <timeInterval><start>2025-10-02T00:00Z</start><end>2025-10-02T01:00Z</end></timeInterval>
+      <resolution>PT60M</resolution>
+      <Point><position>1</position><price.amount>99</price.amount></Point>
+    </Period>
+  </TimeSeries>
+</Publication_MarketDocument>`
+
+	var doc PublicationMarketDocument
+	if err := xml.Unmarshal([]byte(document), &doc); err != nil {
+		t.Fatalf("Unable to parse document: %v", err)
+	}
+
+	start := time.Date(2025, 10, 1, 22, 0, 0, 0, time.UTC)
+	got, err := parsePrices(&doc, start, start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("parsePrices() error = %v", err)
+	}
+
+	// the hourly point overlaps the earlier time series and is dropped
+	want := []struct {
+		minutes int
+		price   float64
+	}{{0, 4}, {15, 4}, {30, 2}, {45, 2}, {120, 3}, {135, 1}}
+
+	if len(got) != len(want) {
+		t.Fatalf("parsePrices() = %v, want %d slots", got, len(want))
+	}
+	for i, w := range want {
+		wantStart := start.Add(time.Duration(w.minutes) * time.Minute)
+		if !got[i].Start.Equal(wantStart) || !got[i].End.Equal(wantStart.Add(15*time.Minute)) || got[i].Price != w.price {
+			t.Errorf("parsePrices()[%d] = '%v', want '%v' at %v", i, got[i], w.price, wantStart)
+		}
+	}
+}
+
+func TestDayStart(t *testing.T) {
+	tests := []struct {
+		name   string
+		t      time.Time
+		want   time.Time
+		length time.Duration
+	}{
+		{"winter", time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC), time.Date(2024, 1, 15, 22, 0, 0, 0, time.UTC), 24 * time.Hour},
+		{"before midnight UTC", time.Date(2024, 1, 15, 22, 30, 0, 0, time.UTC), time.Date(2024, 1, 15, 22, 0, 0, 0, time.UTC), 24 * time.Hour},
+		{"DST starts", time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC), time.Date(2024, 3, 30, 22, 0, 0, 0, time.UTC), 23 * time.Hour},
+		{"DST ends", time.Date(2024, 10, 27, 12, 0, 0, 0, time.UTC), time.Date(2024, 10, 26, 21, 0, 0, 0, time.UTC), 25 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := finland.dayStart(tt.t)
+			if !got.Equal(tt.want) {
+				t.Errorf("dayStart() = '%v', want '%v'", got.UTC(), tt.want)
+			}
+			if length := got.AddDate(0, 0, 1).Sub(got); length != tt.length {
+				t.Errorf("day length = '%v', want '%v'", length, tt.length)
+			}
+		})
+	}
+}
+
+func TestEntsoeAcknowledgement(t *testing.T) {
+	timeNow = func() time.Time { return time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC) }
+	defer func() { timeNow = time.Now }()
+
+	tests := []struct {
+		name    string
+		status  int
+		reason  string
+		want    string
+		wantErr bool
+	}{
+		{"no data", http.StatusOK, "No matching data found for Data item ENERGY_PRICES [12.1.D] (10YFI-1--------U, 10YFI-1--------U) and interval 2024-01-15T22:00:00.000Z/2024-01-16T22:00:00.000Z.", "No electricity prices available", false},
+		{"invalid token", http.StatusUnauthorized, "Unauthorized. Missing or invalid security token", "", true},
+		{"bad request", http.StatusBadRequest, "The combination of [in_Domain, out_Domain] is not valid for this query", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.WriteHeader(tt.status)
+				_, _ = fmt.Fprintf(w, `<Acknowledgement_MarketDocument xmlns="urn:iec62325.351:tc57wg16:451-1:acknowledgementdocument:7:0"><mRID>1</mRID><Reason><code>999</code><text>%s</text></Reason></Acknowledgement_MarketDocument>`, tt.reason)
+			}))
+			defer server.Close()
+			t.Setenv(entsoeClient.BaseURLEnv(), server.URL)
+
+			got, err := CurrentPrices(context.Background(), finland, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CurrentPrices() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CurrentPrices() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
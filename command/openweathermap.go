@@ -1,17 +1,29 @@
 package command
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
-	"os"
 	"strconv"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/httpclient"
 	"github.com/lepinkainen/lambdabot/lambda"
+	"github.com/lepinkainen/lambdabot/ratelimit"
 )
 
+// openWeatherClient calls the OpenWeatherMap geocoding and One Call APIs
+var openWeatherClient = httpclient.New(httpclient.Config{
+	Name:    "openweathermap",
+	BaseURL: "https://api.openweathermap.org",
+	Timeout: 5 * time.Second,
+})
+
 // GeocodingResponse represents the response from OpenWeatherMap Geocoding API
 type GeocodingResponse []struct {
 	Name    string  `json:"name"`
@@ -67,48 +79,81 @@ type Alert struct {
 }
 
 // OpenWeather command handler using One Call API 3.0
-func OpenWeather(args string) (string, error) {
-	if args == "" {
-		args = "Helsinki"
+func OpenWeather(ctx context.Context, args string) (string, error) {
+	locationName, country, weatherData, err := fetchWeather(ctx, args)
+	if err != nil {
+		return "", err
+	}
+
+	return formatWeatherResponse(locationName, country, weatherData), nil
+}
+
+// weatherHandler returns the current weather as the first result line and every alert as its own line
+func weatherHandler(ctx context.Context, cmd *lambda.Command) (string, error) {
+	locationName, country, weatherData, err := fetchWeather(ctx, cmd.Arguments)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range weatherLines(locationName, country, weatherData) {
+		cmd.AddLine(line)
 	}
 
-	appid := os.Getenv("OPENWEATHERMAP_API_KEY")
+	// Old clients get the summary with only the first alert
+	return formatWeatherResponse(locationName, country, weatherData), nil
+}
+
+// fetchWeather geocodes the location and fetches its weather, the location defaults to Helsinki
+func fetchWeather(ctx context.Context, location string) (name, country string, weatherData *OneCallResponse, err error) {
+	if location == "" {
+		location = "Helsinki"
+	}
+
+	appid := config.Get("OPENWEATHERMAP_API_KEY")
 	if appid == "" {
-		return "", fmt.Errorf("OPENWEATHERMAP_API_KEY environment variable not set")
+		return "", "", nil, fmt.Errorf("OPENWEATHERMAP_API_KEY environment variable not set")
 	}
 
 	// Get coordinates for the location
-	lat, lon, locationName, country, err := getCoordinates(appid, args)
+	lat, lon, name, country, err := getCoordinates(ctx, appid, location)
 	if err != nil {
-		return "", fmt.Errorf("unable to geocode location %s: %v", args, err)
+		return "", "", nil, fmt.Errorf("unable to geocode location %s: %v", location, err)
 	}
 
 	// Get weather data from One Call API
-	weatherData, err := getOneCallWeather(appid, lat, lon)
+	weatherData, err = getOneCallWeather(ctx, appid, lat, lon)
 	if err != nil {
-		return "", fmt.Errorf("unable to get weather data: %v", err)
+		return "", "", nil, fmt.Errorf("unable to get weather data: %v", err)
 	}
 
-	return formatWeatherResponse(locationName, country, weatherData), nil
+	return name, country, weatherData, nil
 }
 
 // getCoordinates gets latitude and longitude for a location
-func getCoordinates(appid, location string) (lat, lon float64, name, country string, err error) {
+func getCoordinates(ctx context.Context, appid, location string) (lat, lon float64, name, country string, err error) {
+	ctx, span := lambda.StartSpan(ctx, "getCoordinates", trace.SpanKindInternal, attribute.String("location", location))
+	defer func() {
+		lambda.EndSpan(span, err)
+	}()
+
 	// Geocoding API call with URL encoding for location
-	geoURL := fmt.Sprintf("http://api.openweathermap.org/geo/1.0/direct?q=%s&limit=1&appid=%s", url.QueryEscape(location), appid)
-	resp, err := http.Get(geoURL)
+	query := url.Values{
+		"q":     {location},
+		"limit": {"1"},
+		"appid": {appid},
+	}
+
+	resp, err := openWeatherClient.Get(ctx, "/geo/1.0/direct", query)
 	if err != nil {
 		return 0, 0, "", "", fmt.Errorf("geocoding API request failed: %v", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0, 0, "", "", fmt.Errorf("failed to read geocoding response: %v", err)
+	if !resp.OK() {
+		return 0, 0, "", "", fmt.Errorf("geocoding API returned status %d", resp.StatusCode)
 	}
 
 	var geoData GeocodingResponse
-	err = json.Unmarshal(body, &geoData)
+	err = json.Unmarshal(resp.Body, &geoData)
 	if err != nil {
 		return 0, 0, "", "", fmt.Errorf("failed to parse geocoding response: %v", err)
 	}
@@ -122,29 +167,31 @@ func getCoordinates(appid, location string) (lat, lon float64, name, country str
 }
 
 // getOneCallWeather fetches weather data from One Call API 3.0
-func getOneCallWeather(appid string, lat, lon float64) (*OneCallResponse, error) {
-	apiURL := fmt.Sprintf("https://api.openweathermap.org/data/3.0/onecall?lat=%s&lon=%s&appid=%s&units=metric&exclude=minutely,hourly,daily",
-		strconv.FormatFloat(lat, 'f', 6, 64),
-		strconv.FormatFloat(lon, 'f', 6, 64),
-		appid)
+func getOneCallWeather(ctx context.Context, appid string, lat, lon float64) (weather *OneCallResponse, err error) {
+	ctx, span := lambda.StartSpan(ctx, "getOneCallWeather", trace.SpanKindInternal, attribute.Float64("lat", lat), attribute.Float64("lon", lon))
+	defer func() {
+		lambda.EndSpan(span, err)
+	}()
 
-	resp, err := http.Get(apiURL)
+	query := url.Values{
+		"lat":     {strconv.FormatFloat(lat, 'f', 6, 64)},
+		"lon":     {strconv.FormatFloat(lon, 'f', 6, 64)},
+		"appid":   {appid},
+		"units":   {"metric"},
+		"exclude": {"minutely,hourly,daily"},
+	}
+
+	resp, err := openWeatherClient.Get(ctx, "/data/3.0/onecall", query)
 	if err != nil {
 		return nil, fmt.Errorf("one Call API request failed: %v", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("one Call API returned status %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read One Call API response: %v", err)
-	}
-
 	var weatherData OneCallResponse
-	err = json.Unmarshal(body, &weatherData)
+	err = json.Unmarshal(resp.Body, &weatherData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse One Call API response: %v", err)
 	}
@@ -152,15 +199,13 @@ func getOneCallWeather(appid string, lat, lon float64) (*OneCallResponse, error)
 	return &weatherData, nil
 }
 
-// formatWeatherResponse formats the weather data into a human-readable string
-func formatWeatherResponse(locationName, country string, weatherData *OneCallResponse) string {
-	current := weatherData.Current
+// formatCurrentWeather formats the current conditions without alerts
+func formatCurrentWeather(locationName, country string, current *CurrentWeather) string {
 	description := ""
 	if len(current.Weather) > 0 {
 		description = current.Weather[0].Description
 	}
 
-	// Build base response
 	result := fmt.Sprintf("%s, %s: Temperature: %.1f°C, feels like: %.1f°C, wind: %.1f m/s, humidity: %d%%, pressure: %dhPa, cloudiness: %d%%, %s",
 		locationName, country, current.Temp, current.FeelsLike, current.WindSpeed, current.Humidity, current.Pressure, current.Clouds, description)
 
@@ -169,6 +214,35 @@ func formatWeatherResponse(locationName, country string, weatherData *OneCallRes
 		result += fmt.Sprintf(", UV index: %.1f", current.UVI)
 	}
 
+	return result
+}
+
+// weatherLines returns the current weather as one line followed by a warning line for each alert
+func weatherLines(locationName, country string, weatherData *OneCallResponse) []lambda.ResultLine {
+	lines := []lambda.ResultLine{{
+		Text:  formatCurrentWeather(locationName, country, &weatherData.Current),
+		Title: fmt.Sprintf("%s, %s", locationName, country),
+	}}
+
+	for _, alert := range weatherData.Alerts {
+		text := alert.Event
+		if alert.End > 0 {
+			text += fmt.Sprintf(" until %s", time.Unix(alert.End, 0).UTC().Format("2006-01-02 15:04 UTC"))
+		}
+		lines = append(lines, lambda.ResultLine{
+			Text:     text,
+			Title:    alert.SenderName,
+			Severity: lambda.SeverityWarning,
+		})
+	}
+
+	return lines
+}
+
+// formatWeatherResponse formats the weather data into a human-readable string
+func formatWeatherResponse(locationName, country string, weatherData *OneCallResponse) string {
+	result := formatCurrentWeather(locationName, country, &weatherData.Current)
+
 	// Add weather alerts if any
 	if len(weatherData.Alerts) > 0 {
 		if len(weatherData.Alerts) == 1 {
@@ -183,8 +257,22 @@ func formatWeatherResponse(locationName, country string, weatherData *OneCallRes
 }
 
 func init() {
-	lambda.RegisterHandler("weather", OpenWeather)
-	lambda.RegisterHandler("forecast", OpenWeather)
+	config.Register(config.Setting{Key: "OPENWEATHERMAP_API_KEY", Description: "OpenWeatherMap API key for weather", Secret: true})
+
+	lambda.Register(lambda.Handler{
+		Name:     "weather",
+		Aliases:  []string{"forecast"},
+		Summary:  "Current weather and alerts from OpenWeatherMap",
+		Usage:    "weather [location], defaults to Helsinki",
+		Examples: []string{"weather Tampere", "weather London, GB"},
+		Category: "weather",
+		CacheTTL: lambda.FixedTTL(10 * time.Minute),
+		// One Call API has a daily quota
+		UserLimit:   ratelimit.Limit{Burst: 10, Period: time.Minute},
+		SourceLimit: ratelimit.Limit{Burst: 60, Period: time.Hour},
+		Requires:    []string{"OPENWEATHERMAP_API_KEY"},
+		Func:        weatherHandler,
+	})
 }
 
 // TODO: Enhanced forecasts using One Call API 3.0 hourly/daily data
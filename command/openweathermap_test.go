@@ -1,6 +1,7 @@
 package command
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -8,6 +9,12 @@ import (
 	"os"
 	"strings"
 	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/lepinkainen/lambdabot/lambda"
 )
 
 func TestFormatWeatherResponse(t *testing.T) {
@@ -169,7 +176,7 @@ func TestOpenWeatherMissingAPIKey(t *testing.T) {
 		}
 	}()
 
-	_, err := OpenWeather("Helsinki")
+	_, err := OpenWeather(context.Background(), "Helsinki")
 	if err == nil {
 		t.Error("Expected error when API key is missing")
 	}
@@ -193,7 +200,7 @@ func TestOpenWeatherDefaultLocation(t *testing.T) {
 		}
 	}()
 
-	_, err := OpenWeather("")
+	_, err := OpenWeather(context.Background(), "")
 	// Should get API key error, not a location parsing error
 	if err == nil || !strings.Contains(err.Error(), "OPENWEATHERMAP_API_KEY") {
 		t.Errorf("Expected API key error, got: %v", err)
@@ -239,3 +246,120 @@ func TestFormatWeatherResponseMultipleAlerts(t *testing.T) {
 		}
 	}
 }
+
+func TestWeatherLines(t *testing.T) {
+	weatherData := &OneCallResponse{
+		Current: CurrentWeather{
+			Temp: 25.0,
+			Weather: []WeatherCondition{{
+				Description: "thunderstorm",
+			}},
+		},
+		Alerts: []Alert{
+			{SenderName: "FMI", Event: "Severe Thunderstorm Warning", End: 1750000000},
+			{Event: "Flash Flood Watch"},
+		},
+	}
+
+	lines := weatherLines("Dallas", "US", weatherData)
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines, got %d: %v", len(lines), lines)
+	}
+
+	if lines[0].Title != "Dallas, US" || !strings.Contains(lines[0].Text, "thunderstorm") || strings.Contains(lines[0].Text, "⚠️") {
+		t.Errorf("Unexpected weather line: %+v", lines[0])
+	}
+
+	if lines[1].Severity != lambda.SeverityWarning || lines[1].Title != "FMI" || lines[1].Text != "Severe Thunderstorm Warning until 2025-06-15 15:06 UTC" {
+		t.Errorf("Unexpected first alert line: %+v", lines[1])
+	}
+
+	if lines[2].Severity != lambda.SeverityWarning || lines[2].Text != "Flash Flood Watch" {
+		t.Errorf("Unexpected second alert line: %+v", lines[2])
+	}
+}
+
+// openWeatherResponses geocode Tampere and answer with its weather and two alerts
+var openWeatherResponses = []response{
+	{Path: "/geo/1.0/direct", Query: "limit=1&q=Tampere", Status: http.StatusOK, ContentType: "application/json; charset=utf-8",
+		Body: `[{"name":"Tampere","local_names":{"fi":"Tampere","sv":"Tammerfors"},"lat":61.4980214,"lon":23.7603118,"country":"FI","state":"Pirkanmaa"}]`},
+	{Path: "/geo/1.0/direct", Query: "limit=1&q=Nowhereville", Status: http.StatusOK, ContentType: "application/json; charset=utf-8",
+		Body: `[]`},
+	{Path: "/data/3.0/onecall", Query: "exclude=minutely%2Chourly%2Cdaily&lat=61.498021&lon=23.760312&units=metric", Status: http.StatusOK, ContentType: "application/json; charset=utf-8",
+		Body: `{"lat":61.498,"lon":23.7603,"timezone":"Europe/Helsinki","timezone_offset":10800,"current":{"dt":1718452800,"sunrise":1718413989,"sunset":1718482123,"temp":17.43,"feels_like":16.81,"pressure":1012,"humidity":62,"dew_point":10.04,"uvi":4.21,"clouds":75,"visibility":10000,"wind_speed":5.66,"wind_deg":250,"wind_gust":9.77,"weather":[{"id":803,"main":"Clouds","description":"broken clouds","icon":"04d"}]},"alerts":[{"sender_name":"FMI","event":"Wind warning","start":1718445600,"end":1718488800,"description":"Strong winds on lake areas.","tags":["Wind"]},{"sender_name":"FMI","event":"Forest fire warning","start":1718427600,"end":1718560800,"description":"The risk of forest fires is high.","tags":["Fire warning"]}]}`},
+}
+
+func TestOpenWeather(t *testing.T) {
+	useFixture(t, openWeatherClient, openWeatherResponses...)
+	setReplayKey(t, "OPENWEATHERMAP_API_KEY")
+
+	got, err := OpenWeather(context.Background(), "Tampere")
+	if err != nil {
+		t.Fatalf("OpenWeather() error = %v", err)
+	}
+	if *live {
+		return
+	}
+
+	want := "Tampere, FI: Temperature: 17.4°C, feels like: 16.8°C, wind: 5.7 m/s, humidity: 62%, pressure: 1012hPa, cloudiness: 75%, broken clouds, UV index: 4.2 ⚠️ Wind warning (+1 more alerts)"
+	if got != want {
+		t.Errorf("OpenWeather() = '%v', want '%v'", got, want)
+	}
+
+	_, err = OpenWeather(context.Background(), "Nowhereville")
+	if err == nil || !strings.Contains(err.Error(), "location not found: Nowhereville") {
+		t.Errorf("Expected location not found error, got: %v", err)
+	}
+}
+
+func TestOpenWeatherInvalidKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"cod":401, "message": "Invalid API key."}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	t.Setenv(openWeatherClient.BaseURLEnv(), server.URL)
+
+	_, _, _, _, err := getCoordinates(context.Background(), "invalid", "Tampere")
+	if err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("getCoordinates() error = %v, want status 401", err)
+	}
+}
+
+func TestOpenWeatherSpans(t *testing.T) {
+	useFixture(t, openWeatherClient, openWeatherResponses...)
+	setReplayKey(t, "OPENWEATHERMAP_API_KEY")
+
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(previous)
+
+	ctx, root := otel.Tracer("test").Start(context.Background(), "test")
+	if _, err := OpenWeather(ctx, "Tampere"); err != nil {
+		t.Fatalf("OpenWeather() error = %v", err)
+	}
+	root.End()
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		if s.SpanContext.TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %s has trace %s, want %s", s.Name, s.SpanContext.TraceID(), root.SpanContext().TraceID())
+		}
+		spans[s.Name] = s
+	}
+
+	// the HTTP call of each step is a child of the step
+	for _, step := range []string{"getCoordinates", "getOneCallWeather"} {
+		s, ok := spans[step]
+		if !ok {
+			t.Errorf("no %s span in %v", step, spans)
+			continue
+		}
+		if s.Parent.SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("%s parent = %s, want %s", step, s.Parent.SpanID(), root.SpanContext().SpanID())
+		}
+	}
+	if len(spans) != 4 {
+		t.Errorf("recorded spans %v, want test, getCoordinates, getOneCallWeather and HTTP GET", spans)
+	}
+}
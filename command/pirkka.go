@@ -1,43 +1,54 @@
 package command
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
-	"net/http"
+	"time"
 
+	"github.com/pkg/errors"
+
+	"github.com/lepinkainen/lambdabot/httpclient"
 	"github.com/lepinkainen/lambdabot/lambda"
 )
 
+// pirkkaClient calls the Pirkka beer price API
+var pirkkaClient = httpclient.New(httpclient.Config{
+	Name:    "pirkka",
+	BaseURL: "https://juho.tech",
+	Timeout: 5 * time.Second,
+})
+
 type Price struct {
 	Price float64 `json:"price"`
 }
 
 // Grab Pirkka price from API and respond
-func Pirkka(_ string) (string, error) {
-	url := "https://juho.tech/api/pirkka_price"
-
-	response, err := http.Get(url)
+func Pirkka(ctx context.Context, _ string) (string, error) {
+	response, err := pirkkaClient.Get(ctx, "/api/pirkka_price", nil)
 	if err != nil {
-		log.Fatal(err)
+		return "", errors.Wrap(err, "Unable to get Pirkka price")
 	}
-	defer response.Body.Close()
-
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		log.Fatal(err)
+	if !response.OK() {
+		return "", errors.Errorf("Pirkka price API returned status %d", response.StatusCode)
 	}
 
 	var price Price
-	err = json.Unmarshal(body, &price)
+	err = json.Unmarshal(response.Body, &price)
 	if err != nil {
-		log.Fatal(err)
+		return "", errors.Wrap(err, "Unable to parse Pirkka price")
 	}
 
 	return fmt.Sprintf("Pirkka olut: %.2f €", price.Price), nil
 }
 
 func init() {
-	lambda.RegisterHandler("pirkka", Pirkka)
+	lambda.Register(lambda.Handler{
+		Name:     "pirkka",
+		Summary:  "Current price of a Pirkka beer",
+		Usage:    "pirkka",
+		Category: "prices",
+		CacheTTL: lambda.FixedTTL(time.Hour),
+		Func:     lambda.ArgsHandler(Pirkka),
+	})
 }
@@ -0,0 +1,38 @@
+package command
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// pirkkaResponses has a made-up price of the beer
+var pirkkaResponses = []response{
+	{Path: "/api/pirkka_price", Status: http.StatusOK, ContentType: "application/json",
+		Body: `{"price":1.39}`},
+}
+
+func TestPirkka(t *testing.T) {
+	useFixture(t, pirkkaClient, pirkkaResponses...)
+
+	got, err := Pirkka(context.Background(), "")
+	if err != nil {
+		t.Fatalf("Pirkka() error = %v", err)
+	}
+	if !*live && got != "Pirkka olut: 1.39 €" {
+		t.Errorf("Pirkka() = '%v', want 'Pirkka olut: 1.39 €'", got)
+	}
+}
+
+func TestPirkkaUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<html>maintenance</html>"))
+	}))
+	defer server.Close()
+	t.Setenv(pirkkaClient.BaseURLEnv(), server.URL)
+
+	if _, err := Pirkka(context.Background(), ""); err == nil {
+		t.Error("Pirkka() with an invalid response = nil error, want an error")
+	}
+}
@@ -1,9 +1,9 @@
 package command
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 	"time"
@@ -11,11 +11,20 @@ import (
 	"github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
 
+	"github.com/lepinkainen/lambdabot/httpclient"
 	"github.com/lepinkainen/lambdabot/lambda"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// tvmazeClient calls the TVMaze API, responses embed every episode of the show so they can be large
+var tvmazeClient = httpclient.New(httpclient.Config{
+	Name:        "tvmaze",
+	BaseURL:     "http://api.tvmaze.com",
+	Timeout:     5 * time.Second,
+	MaxBodySize: 8 << 20,
+})
+
 // TVMazeResponse asd
 type TVMazeResponse struct {
 	ID           int        `json:"id"`
@@ -91,8 +100,7 @@ func parseResponse(bytes []byte) (TVMazeResponse, error) {
 
 	err := json.Unmarshal(bytes, &data)
 	if err != nil {
-		log.Errorf("Unable to unmarshal result JSON: %v", err)
-		return data, err
+		return data, errors.Wrap(err, "Unable to unmarshal result JSON")
 	}
 
 	return data, nil
@@ -119,6 +127,10 @@ func nextEpResponse(data *TVMazeResponse) string {
 }
 
 func latestEpResponse(data *TVMazeResponse) string {
+	// Announced shows don't have any episodes yet
+	if len(data.Embedded.Episodes) == 0 {
+		return fmt.Sprintf("No episodes of %s yet", data.Name)
+	}
 	lastEp := data.Embedded.Episodes[len(data.Embedded.Episodes)-1]
 
 	// Next episode of The Mandalorian 2x02 'Chapter 10: The Confrontation' airs 2020-11-06 (5 days) on Disney+
@@ -133,7 +145,6 @@ func latestEpResponse(data *TVMazeResponse) string {
 	} else {
 		network = data.WebChannel.Name
 	}
-	fmt.Printf("%v\n", lastEp.Airstamp)
 	delta := ""
 
 	// If there is an airtime, store humanized diff
@@ -157,37 +168,88 @@ func latestEpResponse(data *TVMazeResponse) string {
 }
 
 // TVMaze search for tvmaze and list next episode in series
-func TVMaze(args string) (string, error) {
-	query := url.QueryEscape(args)
-	apiurl := fmt.Sprintf("http://api.tvmaze.com/singlesearch/shows?q=%s&embed[]=episodes&embed[]=nextepisode", query)
+func TVMaze(ctx context.Context, args string) (string, error) {
+	response, err := fetchShow(ctx, args)
+	if err != nil {
+		return "", err
+	}
 
-	res, err := http.Get(apiurl)
+	return episodeResponse(&response), nil
+}
+
+// tvmazeHandler adds the episode as a result line with the show name and a link to the episode
+func tvmazeHandler(ctx context.Context, cmd *lambda.Command) (string, error) {
+	response, err := fetchShow(ctx, cmd.Arguments)
 	if err != nil {
-		log.Errorf("Unable to get API response from TVMaze: %v", err)
-		return "", errors.Wrap(err, "Unable to get API response")
+		return "", err
+	}
+
+	cmd.AddLine(lambda.ResultLine{
+		Text:  episodeResponse(&response),
+		Title: response.Name,
+		URL:   episodeURL(&response),
+	})
+
+	return "", nil
+}
+
+// fetchShow searches TVMaze for a show with its episodes and next episode embedded
+func fetchShow(ctx context.Context, args string) (TVMazeResponse, error) {
+	query := url.Values{
+		"q":       {args},
+		"embed[]": {"episodes", "nextepisode"},
 	}
-	defer res.Body.Close()
 
-	bytes, err := io.ReadAll(res.Body)
+	res, err := tvmazeClient.Get(ctx, "/singlesearch/shows", query)
 	if err != nil {
-		log.Errorf("Unable to read response from TVMaze: %v", err)
-		return "", errors.Wrap(err, "Unable to read response")
+		log.WithContext(ctx).Errorf("Unable to get API response from TVMaze: %v", err)
+		return TVMazeResponse{}, errors.Wrap(err, "Unable to get API response")
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return TVMazeResponse{}, errors.Errorf("Show %q not found", args)
+	}
+	if !res.OK() {
+		return TVMazeResponse{}, errors.Errorf("TVMaze API returned status %d", res.StatusCode)
 	}
 
-	response, err := parseResponse(bytes)
+	response, err := parseResponse(res.Body)
 	if err != nil {
-		log.Errorf("Could not parse TVMaze response")
-		return "", err
+		log.WithContext(ctx).Errorf("Could not parse TVMaze response: %v", err)
+		return TVMazeResponse{}, err
 	}
 
+	return response, nil
+}
+
+// episodeResponse describes the next episode if known, the latest one otherwise
+func episodeResponse(response *TVMazeResponse) string {
 	// Show has known next episode, hasn't ended
 	if response.Embedded.Nextepisode != (Nextepisode{}) {
-		return nextEpResponse(&response), nil
+		return nextEpResponse(response)
 	}
 
-	return latestEpResponse(&response), nil
+	return latestEpResponse(response)
+}
+
+// episodeURL links to the episode episodeResponse describes, or the show page if there is none
+func episodeURL(response *TVMazeResponse) string {
+	if response.Embedded.Nextepisode.URL != "" {
+		return response.Embedded.Nextepisode.URL
+	}
+	if len(response.Embedded.Episodes) > 0 {
+		return response.Embedded.Episodes[len(response.Embedded.Episodes)-1].URL
+	}
+	return response.URL
 }
 
 func init() {
-	lambda.RegisterHandler("ep", TVMaze)
+	lambda.Register(lambda.Handler{
+		Name:     "ep",
+		Summary:  "Next or latest episode of a TV show from TVMaze",
+		Usage:    "ep <show name>",
+		Examples: []string{"ep mandalorian", "ep gilmore girls"},
+		Category: "tv",
+		CacheTTL: lambda.FixedTTL(3 * time.Hour),
+		Func:     tvmazeHandler,
+	})
 }
@@ -1,11 +1,30 @@
 package command
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"regexp"
 	"testing"
 )
 
+// tvmazeResponses have the last two episodes of ended shows, one running show with a next episode and a missing show
+var tvmazeResponses = []response{
+	{Path: "/singlesearch/shows", Query: "embed%5B%5D=episodes&embed%5B%5D=nextepisode&q=obi+wan+kenobi", Status: http.StatusOK, ContentType: "application/json; charset=UTF-8",
+		Body: `{"id":51287,"url":"https://www.tvmaze.com/shows/51287/obi-wan-kenobi","name":"Obi-Wan Kenobi","type":"Scripted","language":"English","genres":["Drama","Action","Science-Fiction"],"status":"Ended","runtime":null,"averageRuntime":48,"premiered":"2022-05-27","ended":"2022-06-22","officialSite":"https://www.disneyplus.com/series/obi-wan-kenobi/2JYKcHv9fRJb","schedule":{"time":"","days":["Wednesday"]},"weight":96,"network":null,"webChannel":{"id":287,"name":"Disney+","country":null,"officialSite":"https://www.disneyplus.com/"},"summary":"<p>The story begins 10 years after the dramatic events of <i>Star Wars: Revenge of the Sith</i>.</p>","updated":1704794652,"_embedded":{"episodes":[{"id":2284601,"url":"https://www.tvmaze.com/episodes/2284601/obi-wan-kenobi-1x05-part-v","name":"Part V","season":1,"number":5,"type":"regular","airdate":"2022-06-15","airtime":"","airstamp":"2022-06-15T12:00:00+00:00","runtime":50,"rating":{"average":null},"summary":""},{"id":2284602,"url":"https://www.tvmaze.com/episodes/2284602/obi-wan-kenobi-1x06-part-vi","name":"Part VI","season":1,"number":6,"type":"regular","airdate":"2022-06-22","airtime":"","airstamp":"2022-06-22T12:00:00+00:00","runtime":54,"rating":{"average":null},"summary":""}]}}`},
+	{Path: "/singlesearch/shows", Query: "embed%5B%5D=episodes&embed%5B%5D=nextepisode&q=gilmore+girls", Status: http.StatusOK, ContentType: "application/json; charset=UTF-8",
+		Body: `{"id":525,"url":"https://www.tvmaze.com/shows/525/gilmore-girls","name":"Gilmore Girls","type":"Scripted","language":"English","genres":["Drama","Comedy","Romance"],"status":"Ended","runtime":60,"averageRuntime":60,"premiered":"2000-10-05","ended":"2007-05-15","officialSite":null,"schedule":{"time":"21:00","days":["Tuesday"]},"weight":96,"network":{"id":5,"name":"The CW","country":{"name":"United States","code":"US","timezone":"America/New_York"},"officialSite":"https://www.cwtv.com/"},"webChannel":null,"summary":"<p><b>Gilmore Girls</b> is a drama centering around the relationship between a thirtysomething single mother and her teen daughter living in Stars Hollow, Connecticut.</p>","updated":1704794210,"_embedded":{"episodes":[{"id":47100,"url":"https://www.tvmaze.com/episodes/47100/gilmore-girls-7x21-unto-the-breach","name":"Unto the Breach","season":7,"number":21,"type":"regular","airdate":"2007-05-08","airtime":"21:00","airstamp":"2007-05-09T01:00:00+00:00","runtime":60,"rating":{"average":null},"summary":""},{"id":47101,"url":"https://www.tvmaze.com/episodes/47101/gilmore-girls-7x22-bon-voyage","name":"Bon Voyage","season":7,"number":22,"type":"regular","airdate":"2007-05-15","airtime":"21:00","airstamp":"2007-05-16T01:00:00+00:00","runtime":60,"rating":{"average":null},"summary":""}]}}`},
+	{Path: "/singlesearch/shows", Query: "embed%5B%5D=episodes&embed%5B%5D=nextepisode&q=grand+tour", Status: http.StatusOK, ContentType: "application/json; charset=UTF-8",
+		Body: `{"id":3004,"url":"https://www.tvmaze.com/shows/3004/the-grand-tour","name":"The Grand Tour","type":"Reality","language":"English","genres":["Travel"],"status":"Ended","runtime":null,"averageRuntime":68,"premiered":"2016-11-18","ended":"2024-09-13","officialSite":"https://www.amazon.com/dp/B07J2JVKG4","schedule":{"time":"","days":[]},"weight":94,"network":null,"webChannel":{"id":3,"name":"Prime Video","country":null,"officialSite":"https://www.primevideo.com"},"summary":"<p>Jeremy Clarkson, Richard Hammond and James May take their show on the road.</p>","updated":1726233845,"_embedded":{"episodes":[{"id":2766523,"url":"https://www.tvmaze.com/episodes/2766523/the-grand-tour-5x03-the-grand-tour-eurocrash","name":"The Grand Tour: Eurocrash","season":5,"number":3,"type":"regular","airdate":"2023-06-16","airtime":"","airstamp":"2023-06-16T12:00:00+00:00","runtime":95,"rating":{"average":null},"summary":""},{"id":2917211,"url":"https://www.tvmaze.com/episodes/2917211/the-grand-tour-6x01-the-grand-tour-one-for-the-road","name":"The Grand Tour: One for the Road","season":6,"number":1,"type":"regular","airdate":"2024-09-13","airtime":"","airstamp":"2024-09-13T12:00:00+00:00","runtime":116,"rating":{"average":null},"summary":""}]}}`},
+	{Path: "/singlesearch/shows", Query: "embed%5B%5D=episodes&embed%5B%5D=nextepisode&q=the+mandalorian", Status: http.StatusOK, ContentType: "application/json; charset=UTF-8",
+		Body: `{"id":38963,"url":"https://www.tvmaze.com/shows/38963/the-mandalorian","name":"The Mandalorian","type":"Scripted","language":"English","genres":["Action","Adventure","Science-Fiction"],"status":"Running","runtime":null,"averageRuntime":40,"premiered":"2019-11-12","ended":null,"officialSite":"https://www.disneyplus.com/series/the-mandalorian/3jLIGMDYINqD","schedule":{"time":"","days":["Friday"]},"weight":99,"network":null,"webChannel":{"id":287,"name":"Disney+","country":null,"officialSite":"https://www.disneyplus.com/"},"summary":"<p>After the fall of the Galactic Empire, lawlessness has spread throughout the galaxy.</p>","updated":1704794211,"_embedded":{"episodes":[{"id":1968123,"url":"https://www.tvmaze.com/episodes/1968123/the-mandalorian-2x01-chapter-9-the-marshal","name":"Chapter 9: The Marshal","season":2,"number":1,"type":"regular","airdate":"2020-10-30","airtime":"","airstamp":"2020-10-30T12:00:00+00:00","runtime":54,"rating":{"average":null},"summary":""}],"nextepisode":{"id":1968124,"url":"https://www.tvmaze.com/episodes/1968124/the-mandalorian-2x02-chapter-10-the-passenger","name":"Chapter 10: The Passenger","season":2,"number":2,"type":"regular","airdate":"2020-11-06","airtime":"","airstamp":"2020-11-06T12:00:00+00:00","runtime":null,"rating":{"average":null},"summary":""}}}`},
+	{Path: "/singlesearch/shows", Query: "embed%5B%5D=episodes&embed%5B%5D=nextepisode&q=no+such+show+xyzzy", Status: http.StatusNotFound, ContentType: "application/json; charset=UTF-8",
+		Body: `{"name":"Not Found","message":"","code":0,"status":404}`},
+}
+
 func TestTVMaze(t *testing.T) {
+	useFixture(t, tvmazeClient, tvmazeResponses...)
+
 	type args struct {
 		args string
 	}
@@ -18,18 +37,39 @@ func TestTVMaze(t *testing.T) {
 		{"Obi-Wan Kenobi", args{args: "obi wan kenobi"}, regexp.MustCompile(`^Latest episode of Obi-Wan Kenobi 1x06 'Part VI' airs 2022-06-22 \([^)]+\) on Disney\+ \[Ended\]$`), false},
 		{"Gilmore Girls", args{args: "gilmore girls"}, regexp.MustCompile(`^Latest episode of Gilmore Girls 7x22 'Bon Voyage' airs 2007-05-15 \([^)]+\) on The CW \[Ended\]$`), false},
 		{"The Grand Tour", args{args: "grand tour"}, regexp.MustCompile(`^Latest episode of The Grand Tour 6x01 'The Grand Tour: One for the Road' airs 2024-09-13 \([^)]+\) on Prime Video( \[Ended\])?$`), false},
+		{"The Mandalorian", args{args: "the mandalorian"}, regexp.MustCompile(`^Next episode of The Mandalorian 2x02 'Chapter 10: The Passenger' airs 2020-11-06 \([^)]+\) on Disney\+$`), false},
+		{"Not found", args{args: "no such show xyzzy"}, regexp.MustCompile(`^$`), true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			got, err := TVMaze(tt.args.args)
+			got, err := TVMaze(context.Background(), tt.args.args)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("TVMaze() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !tt.want.MatchString(got) {
+			if !*live && !tt.want.MatchString(got) {
 				t.Errorf("TVMaze() = '%v', want match '%v'", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestEpisodeResponseWithoutEpisodes(t *testing.T) {
+	got := episodeResponse(&TVMazeResponse{Name: "Announced Show"})
+	if got != "No episodes of Announced Show yet" {
+		t.Errorf("episodeResponse() = '%v', want 'No episodes of Announced Show yet'", got)
+	}
+}
+
+func TestTVMazeUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"name":"Forbidden","status":403}`, http.StatusForbidden)
+	}))
+	defer server.Close()
+	t.Setenv(tvmazeClient.BaseURLEnv(), server.URL)
+
+	if got, err := TVMaze(context.Background(), "gilmore girls"); err == nil {
+		t.Errorf("TVMaze() with an error response = '%v', want an error", got)
+	}
+}
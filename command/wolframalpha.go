@@ -1,42 +1,71 @@
 package command
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
-	"os"
+	"time"
 
 	"github.com/pkg/errors"
 
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/httpclient"
 	"github.com/lepinkainen/lambdabot/lambda"
+	"github.com/lepinkainen/lambdabot/ratelimit"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// wolframAlphaClient calls the Wolfram Alpha short answers API
+var wolframAlphaClient = httpclient.New(httpclient.Config{
+	Name:    "wolframalpha",
+	BaseURL: "http://api.wolframalpha.com",
+	Timeout: 8 * time.Second,
+})
+
 // WolframAlpha queries Wolfram Alpha for answers
-func WolframAlpha(args string) (string, error) {
+func WolframAlpha(ctx context.Context, args string) (string, error) {
 
-	appid := os.Getenv("WOLFRAM_ALPHA_API_KEY")
-	query := url.QueryEscape(args)
-	apiurl := fmt.Sprintf("http://api.wolframalpha.com/v1/result?appid=%s&units=metric&i=%s", appid, query)
+	appid := config.Get("WOLFRAM_ALPHA_API_KEY")
+	if appid == "" {
+		return "", errors.New("WOLFRAM_ALPHA_API_KEY not set")
+	}
 
-	res, err := http.Get(apiurl)
-	if err != nil {
-		log.Errorf("Unable to get API response from WolframAlpha: %v", err)
-		return "", errors.Wrap(err, "Unable to get API response")
+	query := url.Values{
+		"appid": {appid},
+		"units": {"metric"},
+		"i":     {args},
 	}
-	defer res.Body.Close()
 
-	body, err := io.ReadAll(res.Body)
+	res, err := wolframAlphaClient.Get(ctx, "/v1/result", query)
 	if err != nil {
-		log.Errorf("Unable to read response from WolframAlpha: %v", err)
-		return "", errors.Wrap(err, "Unable to read response")
+		log.WithContext(ctx).Errorf("Unable to get API response from WolframAlpha: %v", err)
+		return "", errors.Wrap(err, "Unable to get API response")
+	}
+	// questions without a short answer get 501 with an explanation worth showing,
+	// other errors like an invalid app ID aren't answers
+	if !res.OK() && res.StatusCode != http.StatusNotImplemented {
+		return "", errors.Errorf("Wolfram Alpha API returned status %d: %s", res.StatusCode, res.Body)
 	}
 
-	return fmt.Sprintf("%s = %s", args, string(body)), nil
+	return fmt.Sprintf("%s = %s", args, string(res.Body)), nil
 }
 
 func init() {
-	lambda.RegisterHandler("wa", WolframAlpha)
+	config.Register(config.Setting{Key: "WOLFRAM_ALPHA_API_KEY", Description: "Wolfram Alpha app ID for wa", Secret: true})
+
+	lambda.Register(lambda.Handler{
+		Name:     "wa",
+		Summary:  "Ask Wolfram Alpha for a short answer",
+		Usage:    "wa <question>",
+		Examples: []string{"wa 1kg in pounds", "wa distance to the moon"},
+		Category: "search",
+		CacheTTL: lambda.FixedTTL(time.Hour),
+		// paid API, keep the monthly quota safe
+		UserLimit:   ratelimit.Limit{Burst: 5, Period: time.Minute},
+		SourceLimit: ratelimit.Limit{Burst: 20, Period: time.Hour},
+		Requires:    []string{"WOLFRAM_ALPHA_API_KEY"},
+		Func:        lambda.ArgsHandler(WolframAlpha),
+	})
 }
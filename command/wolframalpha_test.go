@@ -1,10 +1,24 @@
-//go:build !ci
-
 package command
 
-import "testing"
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// wolframAlphaResponses answer a conversion and a question the API doesn't understand
+var wolframAlphaResponses = []response{
+	{Path: "/v1/result", Query: "i=1kg+in+pounds&units=metric", Status: http.StatusOK, ContentType: "text/plain;charset=utf-8",
+		Body: `2.205 lb  (pounds)`},
+	{Path: "/v1/result", Query: "i=asdfghjkl+qwerty&units=metric", Status: http.StatusNotImplemented, ContentType: "text/plain;charset=utf-8",
+		Body: `Wolfram|Alpha did not understand your input`},
+}
 
 func TestWolframAlpha(t *testing.T) {
+	useFixture(t, wolframAlphaClient, wolframAlphaResponses...)
+	setReplayKey(t, "WOLFRAM_ALPHA_API_KEY")
+
 	type args struct {
 		args string
 	}
@@ -15,17 +29,31 @@ func TestWolframAlpha(t *testing.T) {
 		wantErr bool
 	}{
 		{"1 kg in pounds", args{args: "1kg in pounds"}, "1kg in pounds = 2.205 lb  (pounds)", false},
+		{"Not understood", args{args: "asdfghjkl qwerty"}, "asdfghjkl qwerty = Wolfram|Alpha did not understand your input", false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := WolframAlpha(tt.args.args)
+			got, err := WolframAlpha(context.Background(), tt.args.args)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("WolframAlpha() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if got != tt.want {
+			if !*live && got != tt.want {
 				t.Errorf("WolframAlpha() = '%v', want '%v'", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestWolframAlphaInvalidKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "Error 1: Invalid appid", http.StatusForbidden)
+	}))
+	defer server.Close()
+	t.Setenv(wolframAlphaClient.BaseURLEnv(), server.URL)
+	t.Setenv("WOLFRAM_ALPHA_API_KEY", "invalid")
+
+	if got, err := WolframAlpha(context.Background(), "1kg in pounds"); err == nil {
+		t.Errorf("WolframAlpha() with an invalid key = '%v', want an error", got)
+	}
+}
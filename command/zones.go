@@ -0,0 +1,109 @@
+package command
+
+import (
+	"strings"
+	"time"
+)
+
+// zone is a bidding zone of the day-ahead market
+type zone struct {
+	// Name is the short name users type, e.g. SE3
+	Name string
+	// EIC is the energy identification code the entso-e API uses for the zone
+	EIC string
+	// Location is the time zone days and times of the zone are shown in
+	Location *time.Location
+	// VAT is the history of VAT rates on electricity, oldest first
+	VAT []vatRate
+}
+
+// VAT rates by country, dated so that historical prices use the rate in effect at the time
+var (
+	vatFinland = []vatRate{{Percent: 24}, {From: "2022-12-01", Percent: 10}, {From: "2023-05-01", Percent: 24}, {From: "2024-09-01", Percent: 25.5}}
+	vatSweden  = []vatRate{{Percent: 25}}
+	vatNorway  = []vatRate{{Percent: 25}}
+	// households in Northern Norway don't pay VAT on electricity
+	vatNorthernNorway = []vatRate{{Percent: 0}}
+	vatDenmark        = []vatRate{{Percent: 25}}
+	vatGermany        = []vatRate{{Percent: 19}, {From: "2020-07-01", Percent: 16}, {From: "2021-01-01", Percent: 19}}
+	vatEstonia        = []vatRate{{Percent: 20}, {From: "2024-01-01", Percent: 22}, {From: "2025-07-01", Percent: 24}}
+	vatLatvia         = []vatRate{{Percent: 21}}
+	vatLithuania      = []vatRate{{Percent: 21}}
+)
+
+// finland is the default zone of sahko
+var finland = zone{Name: "FI", EIC: entsoeDomain, Location: helsinki, VAT: vatFinland}
+
+// zones are the bidding zones around the Baltic Sea and the North Sea
+var zones = []zone{
+	finland,
+	{Name: "SE1", EIC: "10Y1001A1001A44P", Location: mustLoadLocation("Europe/Stockholm"), VAT: vatSweden},
+	{Name: "SE2", EIC: "10Y1001A1001A45N", Location: mustLoadLocation("Europe/Stockholm"), VAT: vatSweden},
+	{Name: "SE3", EIC: "10Y1001A1001A46L", Location: mustLoadLocation("Europe/Stockholm"), VAT: vatSweden},
+	{Name: "SE4", EIC: "10Y1001A1001A47J", Location: mustLoadLocation("Europe/Stockholm"), VAT: vatSweden},
+	{Name: "EE", EIC: "10Y1001A1001A39I", Location: mustLoadLocation("Europe/Tallinn"), VAT: vatEstonia},
+	{Name: "LV", EIC: "10YLV-1001A00074", Location: mustLoadLocation("Europe/Riga"), VAT: vatLatvia},
+	{Name: "LT", EIC: "10YLT-1001A0008Q", Location: mustLoadLocation("Europe/Vilnius"), VAT: vatLithuania},
+	{Name: "NO1", EIC: "10YNO-1--------2", Location: mustLoadLocation("Europe/Oslo"), VAT: vatNorway},
+	{Name: "NO2", EIC: "10YNO-2--------T", Location: mustLoadLocation("Europe/Oslo"), VAT: vatNorway},
+	{Name: "NO3", EIC: "10YNO-3--------J", Location: mustLoadLocation("Europe/Oslo"), VAT: vatNorway},
+	{Name: "NO4", EIC: "10YNO-4--------1", Location: mustLoadLocation("Europe/Oslo"), VAT: vatNorthernNorway},
+	{Name: "NO5", EIC: "10Y1001A1001A48H", Location: mustLoadLocation("Europe/Oslo"), VAT: vatNorway},
+	{Name: "DK1", EIC: "10YDK-1--------W", Location: mustLoadLocation("Europe/Copenhagen"), VAT: vatDenmark},
+	{Name: "DK2", EIC: "10YDK-2--------M", Location: mustLoadLocation("Europe/Copenhagen"), VAT: vatDenmark},
+	{Name: "DE-LU", EIC: "10Y1001A1001A82H", Location: mustLoadLocation("Europe/Berlin"), VAT: vatGermany},
+}
+
+// neighbours are the zones with an interconnection to each zone, compared side by side
+var neighbours = map[string][]string{
+	"FI":    {"SE1", "SE3", "EE", "NO4"},
+	"SE1":   {"FI", "SE2", "NO4"},
+	"SE2":   {"SE1", "SE3", "NO3", "NO4"},
+	"SE3":   {"SE2", "SE4", "FI", "NO1", "DK1"},
+	"SE4":   {"SE3", "DK2", "DE-LU", "LT"},
+	"EE":    {"FI", "LV"},
+	"LV":    {"EE", "LT"},
+	"LT":    {"LV", "SE4"},
+	"NO1":   {"NO2", "NO3", "NO5", "SE3"},
+	"NO2":   {"NO1", "NO5", "DK1", "DE-LU"},
+	"NO3":   {"NO1", "NO4", "NO5", "SE2"},
+	"NO4":   {"NO3", "SE1", "SE2", "FI"},
+	"NO5":   {"NO1", "NO2", "NO3"},
+	"DK1":   {"DK2", "NO2", "SE3", "DE-LU"},
+	"DK2":   {"DK1", "SE4", "DE-LU"},
+	"DE-LU": {"DK1", "DK2", "SE4", "NO2"},
+}
+
+// lookupZone finds a zone by name, case-insensitively. DE works for DE-LU.
+func lookupZone(name string) (zone, bool) {
+	name = strings.ToUpper(name)
+	if name == "DE" {
+		name = "DE-LU"
+	}
+	for _, z := range zones {
+		if z.Name == name {
+			return z, true
+		}
+	}
+	return zone{}, false
+}
+
+// redisKey is the Redis timeseries of the zone, e.g. entsoe:fi
+func (z zone) redisKey() string {
+	return "entsoe:" + strings.ToLower(z.Name)
+}
+
+// label prefixes results of other zones than Finland with the zone name
+func (z zone) label() string {
+	if z.Name == finland.Name {
+		return ""
+	}
+	return z.Name + ": "
+}
+
+// dayStart returns the midnight starting the day of t in the zone.
+// Days follow the local clock, so they're 23 or 25 hours long when DST starts or ends.
+func (z zone) dayStart(t time.Time) time.Time {
+	t = t.In(z.Location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, z.Location)
+}
@@ -0,0 +1,217 @@
+// Package config loads settings from the environment and an optional JSON config file.
+//
+// Environment variables always win over the file. The file is a flat JSON object
+// using the same keys as the environment, e.g. {"REDIS_ADDR": "localhost:6379"},
+// and is read from the path in CONFIG_FILE.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileEnv is the environment variable pointing to the optional config file
+const FileEnv = "CONFIG_FILE"
+
+var (
+	mu         sync.RWMutex
+	fileValues = map[string]string{}
+)
+
+// Load reads the config file from CONFIG_FILE if set and validates all known settings.
+// The returned error lists every problem found, the settings that could be read are usable regardless.
+func Load() error {
+	var problems []string
+
+	path := os.Getenv(FileEnv)
+	values := map[string]string{}
+	if path != "" {
+		var err error
+		values, err = readFile(path)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	mu.Lock()
+	fileValues = values
+	mu.Unlock()
+
+	for _, s := range Settings() {
+		if err := s.Check(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// readFile parses a flat JSON object, numbers and booleans are accepted as values too
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return map[string]string{}, fmt.Errorf("unable to read config file: %v", err)
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return map[string]string{}, fmt.Errorf("unable to parse config file %s: %v", path, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			values[key] = v
+		case float64, bool:
+			values[key] = fmt.Sprint(v)
+		default:
+			return map[string]string{}, fmt.Errorf("config file %s: %s must be a string, number or boolean", path, key)
+		}
+	}
+	return values, nil
+}
+
+// Get returns the value of key from the environment, or the config file if the environment doesn't have it
+func Get(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	return fileValues[key]
+}
+
+// IsSet reports whether key has a non-empty value
+func IsSet(key string) bool {
+	return Get(key) != ""
+}
+
+// Missing returns the keys that have no value.
+// A key can list alternatives separated by "|", e.g. "REDIS_ADDR|ENTSOE_API_KEY" is missing only if neither is set.
+func Missing(keys ...string) []string {
+	var missing []string
+	for _, key := range keys {
+		if !slices.ContainsFunc(strings.Split(key, "|"), IsSet) {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// Int returns key as an integer, or def if it's unset or invalid
+func Int(key string, def int) int {
+	n, err := strconv.Atoi(Get(key))
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// Duration returns key as a duration like "30s", or def if it's unset or invalid
+func Duration(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(Get(key))
+	if err != nil {
+		return def
+	}
+	return d
+}
+
+// Bool returns key as a boolean, anything strconv.ParseBool doesn't understand is false
+func Bool(key string) bool {
+	b, _ := strconv.ParseBool(Get(key))
+	return b
+}
+
+// List returns key as a comma separated list with whitespace and empty items removed
+func List(key string) []string {
+	var items []string
+	for item := range strings.SplitSeq(Get(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Setting is a documented configuration key
+type Setting struct {
+	Key         string
+	Description string
+	// Secret values are never printed
+	Secret bool
+	// Validate checks a non-empty value, nil accepts anything
+	Validate func(value string) error
+}
+
+var settings = map[string]Setting{}
+
+// Register documents a setting so it's validated at startup and shown by the config check
+func Register(s Setting) {
+	settings[s.Key] = s
+}
+
+// Settings returns all registered settings sorted by key
+func Settings() []Setting {
+	list := make([]Setting, 0, len(settings))
+	for _, s := range settings {
+		list = append(list, s)
+	}
+	slices.SortFunc(list, func(a, b Setting) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return list
+}
+
+// Check validates the current value of the setting, unset settings are valid
+func (s Setting) Check() error {
+	value := Get(s.Key)
+	if value == "" || s.Validate == nil {
+		return nil
+	}
+	if err := s.Validate(value); err != nil {
+		return fmt.Errorf("%s: %v", s.Key, err)
+	}
+	return nil
+}
+
+// Display returns the value for printing, secrets are masked
+func (s Setting) Display() string {
+	value := Get(s.Key)
+	switch {
+	case value == "":
+		return "(not set)"
+	case s.Secret:
+		return "(set)"
+	default:
+		return value
+	}
+}
+
+// ValidDuration accepts values time.ParseDuration understands
+func ValidDuration(value string) error {
+	_, err := time.ParseDuration(value)
+	return err
+}
+
+// ValidPositiveInt accepts integers above zero
+func ValidPositiveInt(value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	if n < 1 {
+		return fmt.Errorf("must be at least 1, got %d", n)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"TEST_FILE_ONLY": "from file", "TEST_BOTH": "from file", "TEST_NUMBER": 5, "TEST_TIMEOUT": "2s"}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(FileEnv, path)
+	t.Setenv("TEST_BOTH", "from env")
+	defer func() { fileValues = map[string]string{} }()
+
+	if err := Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if got := Get("TEST_FILE_ONLY"); got != "from file" {
+		t.Errorf("Get(TEST_FILE_ONLY) = %q, want 'from file'", got)
+	}
+	if got := Get("TEST_BOTH"); got != "from env" {
+		t.Errorf("Get(TEST_BOTH) = %q, the environment should win over the file", got)
+	}
+	if got := Int("TEST_NUMBER", 0); got != 5 {
+		t.Errorf("Int(TEST_NUMBER) = %d, want 5", got)
+	}
+	if got := Duration("TEST_TIMEOUT", time.Minute); got != 2*time.Second {
+		t.Errorf("Duration(TEST_TIMEOUT) = %v, want 2s", got)
+	}
+	if got := Duration("TEST_UNSET", time.Minute); got != time.Minute {
+		t.Errorf("Duration(TEST_UNSET) = %v, want the default", got)
+	}
+	if got := Missing("TEST_FILE_ONLY", "TEST_UNSET", "TEST_UNSET|TEST_BOTH"); len(got) != 1 || got[0] != "TEST_UNSET" {
+		t.Errorf("Missing() = %v, want [TEST_UNSET]", got)
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	Register(Setting{Key: "TEST_VALIDATED", Validate: ValidPositiveInt})
+	defer delete(settings, "TEST_VALIDATED")
+
+	t.Setenv(FileEnv, filepath.Join(t.TempDir(), "missing.json"))
+	t.Setenv("TEST_VALIDATED", "zero")
+
+	err := Load()
+	if err == nil {
+		t.Fatal("Load() succeeded, want errors")
+	}
+	for _, want := range []string{"unable to read config file", "TEST_VALIDATED"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error = %v, want it to mention %s", err, want)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	t.Setenv("TEST_LIST", " #a, ,#b ,")
+	if got := List("TEST_LIST"); len(got) != 2 || got[0] != "#a" || got[1] != "#b" {
+		t.Errorf("List() = %q, want [#a #b]", got)
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	t.Setenv("TEST_SECRET", "hunter2")
+	if got := (Setting{Key: "TEST_SECRET", Secret: true}).Display(); got != "(set)" {
+		t.Errorf("Display() = %q, secrets must not be shown", got)
+	}
+	if got := (Setting{Key: "TEST_UNSET"}).Display(); got != "(not set)" {
+		t.Errorf("Display() = %q, want (not set)", got)
+	}
+}
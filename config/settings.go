@@ -0,0 +1,13 @@
+package config
+
+// Settings shared by the whole bot, commands register their own API keys
+func init() {
+	Register(Setting{Key: "RUNMODE", Description: "stdout, http or repl, anything else runs as a Lambda function"})
+	Register(Setting{Key: "REDIS_ADDR", Description: "Redis address for prices, rate limits and the response cache"})
+	Register(Setting{Key: "REDIS_PASSWORD", Description: "Redis password", Secret: true})
+	Register(Setting{Key: "HTTP_ADDR", Description: "Listen address in http mode, default :8080"})
+	Register(Setting{Key: "REQUEST_TIMEOUT", Description: "Maximum time for one request in http mode, default 30s", Validate: ValidDuration})
+	Register(Setting{Key: "BATCH_CONCURRENCY", Description: "Commands of a batch run at the same time, default 4", Validate: ValidPositiveInt})
+	Register(Setting{Key: "CACHE_DISABLED", Description: "Set to disable the response cache"})
+	Register(Setting{Key: "SUGGEST_QUIET_SOURCES", Description: "Comma separated sources that get no reply to unknown commands, * for all"})
+}
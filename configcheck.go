@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/lambda"
+)
+
+// runConfigCheck prints every setting and which commands are missing configuration.
+// Returns the process exit code, non-zero if anything is invalid or missing.
+func runConfigCheck(w io.Writer) int {
+	status := 0
+
+	if err := config.Load(); err != nil {
+		fmt.Fprintf(w, "%v\n\n", err)
+		status = 1
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "SETTING\tVALUE\tDESCRIPTION")
+	for _, s := range config.Settings() {
+		value := s.Display()
+		if err := s.Check(); err != nil {
+			value += " INVALID"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Key, value, s.Description)
+	}
+
+	fmt.Fprintln(tw, "\t\t")
+	fmt.Fprintln(tw, "COMMAND\tSTATUS\t")
+	for _, h := range lambda.Handlers() {
+		state := "ok"
+		if missing := h.MissingConfig(); len(missing) > 0 {
+			state = "missing " + strings.Join(missing, ", ")
+			status = 1
+		}
+		fmt.Fprintf(tw, "%s\t%s\t\n", h.Name, state)
+	}
+
+	_ = tw.Flush()
+	return status
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/lambda"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHTTPAddr       = ":8080"
+	defaultRequestTimeout = 30 * time.Second
+	shutdownTimeout       = 10 * time.Second
+)
+
+// runHTTP serves commands over HTTP until SIGINT or SIGTERM.
+// HTTP_ADDR sets the listen address and REQUEST_TIMEOUT the maximum time for a single request.
+func runHTTP() {
+	addr := config.Get("HTTP_ADDR")
+	if addr == "" {
+		addr = defaultHTTPAddr
+	}
+
+	timeout := config.Duration("REQUEST_TIMEOUT", defaultRequestTimeout)
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           lambda.NewHTTPHandler(timeout),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		// leave room to write the response after a command has used all of its time
+		WriteTimeout: timeout + 5*time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Infof("Listening on %s", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("HTTP server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Info("Shutting down, waiting for running commands to finish")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("Graceful shutdown failed: %v", err)
+	}
+}
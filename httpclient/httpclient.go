@@ -0,0 +1,315 @@
+// Package httpclient is the shared client for calls to upstream APIs.
+//
+// Every upstream service gets its own Client with a timeout, retries with backoff on 5xx and 429 responses,
+// a response size limit and a base URL that can be overridden with <NAME>_BASE_URL, e.g. TVMAZE_BASE_URL.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	cfg "github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Defaults for settings not given in Config
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultMaxRetries  = 2
+	DefaultMaxBodySize = 1 << 20
+	defaultBackoff     = 200 * time.Millisecond
+	maxRetryAfter      = 5 * time.Second
+)
+
+// tracerName is the instrumentation scope of the request spans
+const tracerName = "github.com/lepinkainen/lambdabot/httpclient"
+
+// ErrTooLarge is returned when a response body is over the size limit
+var ErrTooLarge = errors.New("response body over size limit")
+
+// version is shown in the User-Agent header
+var version = "dev"
+
+// SetVersion sets the bot version shown in the User-Agent header
+func SetVersion(v string) {
+	if v != "" {
+		version = v
+	}
+}
+
+// UserAgent is sent with every request
+func UserAgent() string {
+	return fmt.Sprintf("lambdabot/%s (+https://github.com/lepinkainen/lambdabot)", version)
+}
+
+// Config describes an upstream service
+type Config struct {
+	// Name identifies the service in logs and environment variables, e.g. "tvmaze"
+	Name string
+	// BaseURL is the default scheme and host, optionally with a path prefix
+	BaseURL string
+	// Timeout limits a single attempt, the request context can cut it shorter
+	Timeout time.Duration
+	// MaxRetries is the number of retries after a 5xx or 429 response or a transport error
+	MaxRetries int
+	// MaxBodySize is the largest response body accepted, in bytes
+	MaxBodySize int64
+	// Backoff is the wait before the first retry, doubled for every following one
+	Backoff time.Duration
+}
+
+// Client calls a single upstream service
+type Client struct {
+	config Config
+	client *http.Client
+}
+
+// Response is a fully read upstream response
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// OK reports whether the response has a 2xx status
+func (r *Response) OK() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+// New returns a client for the service. Zero settings get the package defaults,
+// <NAME>_TIMEOUT overrides the timeout and <NAME>_BASE_URL the base URL.
+func New(config Config) *Client {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+	if config.MaxRetries < 0 {
+		config.MaxRetries = 0
+	} else if config.MaxRetries == 0 {
+		config.MaxRetries = DefaultMaxRetries
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultMaxBodySize
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = defaultBackoff
+	}
+
+	cfg.Register(cfg.Setting{
+		Key:         envName(config.Name, "BASE_URL"),
+		Description: fmt.Sprintf("Base URL of the %s API, default %s", config.Name, config.BaseURL),
+	})
+	cfg.Register(cfg.Setting{
+		Key:         envName(config.Name, "TIMEOUT"),
+		Description: fmt.Sprintf("Timeout of a single %s request, default %s", config.Name, config.Timeout),
+		Validate:    cfg.ValidDuration,
+	})
+
+	return &Client{
+		config: config,
+		client: &http.Client{},
+	}
+}
+
+// envName is the environment variable for a setting of the named service, e.g. TVMAZE_BASE_URL
+func envName(service, setting string) string {
+	name := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(service))
+	return name + "_" + setting
+}
+
+// Name returns the service name
+func (c *Client) Name() string {
+	return c.config.Name
+}
+
+// BaseURLEnv is the environment variable that overrides the base URL, e.g. TVMAZE_BASE_URL
+func (c *Client) BaseURLEnv() string {
+	return envName(c.config.Name, "BASE_URL")
+}
+
+// BaseURL returns the base URL of the service, <NAME>_BASE_URL overrides the configured one.
+// The setting is read on every call so tests can point the client at a local server.
+func (c *Client) BaseURL() string {
+	if base := cfg.Get(c.BaseURLEnv()); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	return strings.TrimSuffix(c.config.BaseURL, "/")
+}
+
+// Timeout returns the limit of a single attempt, <NAME>_TIMEOUT overrides the configured one.
+// Clients are created before the configuration is loaded, so the setting is read on every request.
+func (c *Client) Timeout() time.Duration {
+	if d := cfg.Duration(envName(c.config.Name, "TIMEOUT"), 0); d > 0 {
+		return d
+	}
+	return c.config.Timeout
+}
+
+// URL joins the base URL, the path and the query
+func (c *Client) URL(path string, query url.Values) string {
+	u := c.BaseURL() + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// Get fetches the path with the query from the service.
+// Non-2xx responses aren't errors, check Response.OK. Errors are transport failures,
+// cancellations and bodies over the size limit.
+func (c *Client) Get(ctx context.Context, path string, query url.Values) (*Response, error) {
+	return c.Do(ctx, http.MethodGet, c.URL(path, query))
+}
+
+// Do makes a request without a body to the full URL, retrying on 5xx, 429 and transport errors
+func (c *Client) Do(ctx context.Context, method, rawURL string) (*Response, error) {
+	var (
+		res *Response
+		err error
+	)
+
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		res, retryAfter, err = c.attempt(ctx, method, rawURL)
+
+		if !c.shouldRetry(ctx, res, err) || attempt >= c.config.MaxRetries {
+			break
+		}
+
+		wait := max(c.backoff(attempt), retryAfter)
+		log.WithContext(ctx).WithField("service", c.config.Name).Warnf("Retrying in %s after attempt %d: %s", wait, attempt+1, describe(res, err))
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+
+	return res, err
+}
+
+// attempt makes a single request and reads the limited body within the timeout
+func (c *Client) attempt(ctx context.Context, method, rawURL string) (*Response, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, http.NoBody)
+	if err != nil {
+		return nil, 0, withoutQuery(err)
+	}
+	req.Header.Set("User-Agent", UserAgent())
+
+	// the query is left out of the span, it can carry API keys
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "HTTP "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("peer.service", c.config.Name),
+			attribute.String("http.request.method", method),
+			attribute.String("server.address", req.URL.Host),
+			attribute.String("url.path", req.URL.Path)))
+	defer span.End()
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	start := time.Now()
+	defer func() {
+		metrics.RecordUpstream(ctx, c.config.Name, time.Since(start))
+	}()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		err = withoutQuery(err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+
+	// read one byte over the limit to tell a body of exactly the limit from a larger one
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.config.MaxBodySize+1))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, 0, err
+	}
+	if int64(len(body)) > c.config.MaxBodySize {
+		span.SetStatus(codes.Error, ErrTooLarge.Error())
+		return nil, 0, fmt.Errorf("%s: %w (%d bytes)", c.config.Name, ErrTooLarge, c.config.MaxBodySize)
+	}
+
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, retryAfter(resp.Header), nil
+}
+
+// shouldRetry retries server errors, rate limits and transport errors, but not cancellations
+func (c *Client) shouldRetry(ctx context.Context, res *Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		// oversized bodies won't get any smaller
+		return !errors.Is(err, ErrTooLarge)
+	}
+	// 501 is an answer, not an outage, e.g. Wolfram Alpha uses it for questions it doesn't understand
+	if res.StatusCode == http.StatusNotImplemented {
+		return false
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
+
+// backoff doubles the wait for every attempt, with up to 50% jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.config.Backoff << attempt
+	return d + rand.N(d/2+1)
+}
+
+// retryAfter parses the Retry-After header in seconds, capped so a single call can't stall the whole Lambda
+func retryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return min(time.Duration(seconds)*time.Second, maxRetryAfter)
+}
+
+// withoutQuery drops the query from the URL of a transport error, it can carry API keys.
+// The error ends up in spans, logs and replies.
+func withoutQuery(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	if u, parseErr := url.Parse(urlErr.URL); parseErr == nil {
+		u.RawQuery, u.Fragment = "", ""
+		urlErr.URL = u.String()
+	} else {
+		// unparseable URLs are cut at the query by hand
+		urlErr.URL, _, _ = strings.Cut(urlErr.URL, "?")
+	}
+	return err
+}
+
+func describe(res *Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("status %d", res.StatusCode)
+}
@@ -0,0 +1,176 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/metrics"
+)
+
+func TestClientRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("User-Agent"), "lambdabot/") {
+			t.Errorf("User-Agent = %q", r.Header.Get("User-Agent"))
+		}
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte("q=" + r.URL.Query().Get("q")))
+		}
+	}))
+	defer server.Close()
+
+	client := New(Config{Name: "test", BaseURL: server.URL, Backoff: time.Millisecond})
+	ctx, upstream := metrics.WithUpstream(context.Background())
+
+	res, err := client.Get(ctx, "/search", url.Values{"q": {"obi wan"}})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if !res.OK() || string(res.Body) != "q=obi wan" {
+		t.Errorf("Get() = %d %q, want 200 'q=obi wan'", res.StatusCode, res.Body)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("server called %d times, want 3", calls.Load())
+	}
+	// every attempt counts as upstream time
+	if got := upstream.Services()["test"].Calls; got != 3 {
+		t.Errorf("recorded %d upstream calls, want 3", got)
+	}
+}
+
+func TestClientGivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := New(Config{Name: "test", BaseURL: server.URL, MaxRetries: 1, Backoff: time.Millisecond})
+
+	res, err := client.Get(context.Background(), "/", nil)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if res.StatusCode != http.StatusBadGateway {
+		t.Errorf("StatusCode = %d, want 502", res.StatusCode)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("server called %d times, want 2", calls.Load())
+	}
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	res, err := New(Config{Name: "test", BaseURL: server.URL}).Get(context.Background(), "/", nil)
+	if err != nil || res.StatusCode != http.StatusNotFound || calls.Load() != 1 {
+		t.Errorf("Get() = %v, %v after %d calls, want a single 404", res, err, calls.Load())
+	}
+}
+
+func TestClientMaxBodySize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer server.Close()
+
+	_, err := New(Config{Name: "test", BaseURL: server.URL, MaxBodySize: 99}).Get(context.Background(), "/", nil)
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Get() error = %v, want ErrTooLarge", err)
+	}
+
+	res, err := New(Config{Name: "test", BaseURL: server.URL, MaxBodySize: 100}).Get(context.Background(), "/", nil)
+	if err != nil || len(res.Body) != 100 {
+		t.Errorf("Get() = %v, %v, want the full body at exactly the limit", res, err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	client := New(Config{Name: "test", BaseURL: server.URL, Timeout: 20 * time.Millisecond, MaxRetries: -1})
+	if _, err := client.Get(context.Background(), "/", nil); err == nil {
+		t.Error("Get() succeeded, want a timeout")
+	}
+}
+
+func TestBaseURLOverride(t *testing.T) {
+	client := New(Config{Name: "open-weather", BaseURL: "https://api.example.com/"})
+	if got := client.URL("/path", nil); got != "https://api.example.com/path" {
+		t.Errorf("URL() = %v", got)
+	}
+
+	t.Setenv("OPEN_WEATHER_BASE_URL", "http://localhost:8080/")
+	if got := client.URL("/path", url.Values{"a": {"1"}}); got != "http://localhost:8080/path?a=1" {
+		t.Errorf("URL() = %v, want the overridden base", got)
+	}
+}
+
+func TestClientTimeoutSetting(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	// the setting can change after the client is created, e.g. when CONFIG_FILE is loaded
+	client := New(Config{Name: "slow", BaseURL: server.URL, Timeout: time.Minute, MaxRetries: -1})
+	t.Setenv("SLOW_TIMEOUT", "20ms")
+
+	if got := client.Timeout(); got != 20*time.Millisecond {
+		t.Errorf("Timeout() = %v, want 20ms", got)
+	}
+	if _, err := client.Get(context.Background(), "/", nil); err == nil {
+		t.Error("Get() succeeded, want a timeout")
+	}
+}
+
+func TestClientErrorWithoutQuery(t *testing.T) {
+	// nothing listens on the port once the listener is closed
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client := New(Config{Name: "closed", BaseURL: "http://" + addr, Backoff: time.Millisecond, MaxRetries: 1})
+
+	_, err = client.Get(context.Background(), "/v1/result", url.Values{"appid": {"SECRETKEY"}})
+	if err == nil {
+		t.Fatal("Get() succeeded, want a connection error")
+	}
+	if strings.Contains(err.Error(), "SECRETKEY") {
+		t.Errorf("Get() error = %v, want the query left out", err)
+	}
+	if !strings.Contains(err.Error(), "/v1/result") {
+		t.Errorf("Get() error = %v, want the path kept", err)
+	}
+}
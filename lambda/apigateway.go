@@ -0,0 +1,86 @@
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// httpEventProbe has just enough of an API Gateway v2 / Function URL event to recognize one
+type httpEventProbe struct {
+	RequestContext struct {
+		HTTP struct {
+			Method string `json:"method"`
+		} `json:"http"`
+	} `json:"requestContext"`
+}
+
+// isHTTPEvent reports whether the payload is an API Gateway HTTP API (v2) or Lambda Function URL event.
+// Both use the same payload format, direct invocations never have a requestContext.
+func isHTTPEvent(payload []byte) bool {
+	var probe httpEventProbe
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return false
+	}
+	return probe.RequestContext.HTTP.Method != ""
+}
+
+// HandleHTTPEvent runs the command of an API Gateway or Function URL request.
+//
+// POST requests carry a Command or an array of Commands as the JSON body,
+// GET requests use the query string: ?command=ep&args=mandalorian&user=nick&source=web
+func HandleHTTPEvent(ctx context.Context, event *events.APIGatewayV2HTTPRequest) events.APIGatewayV2HTTPResponse {
+	var (
+		payload []byte
+		err     error
+	)
+
+	switch event.RequestContext.HTTP.Method {
+	case http.MethodGet:
+		payload, err = json.Marshal(commandFromQuery(event.QueryStringParameters))
+	case http.MethodPost:
+		payload = []byte(event.Body)
+		if event.IsBase64Encoded {
+			payload, err = base64.StdEncoding.DecodeString(event.Body)
+		}
+	default:
+		return httpEventResponse(http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+	if err != nil {
+		return httpEventResponse(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// API Gateway lowercases header names
+	ctx = extractTrace(ctx, propagation.MapCarrier(event.Headers))
+
+	status, body := handleHTTPPayload(ctx, payload)
+	return httpEventResponse(status, body)
+}
+
+// commandFromQuery builds a command from query string parameters
+func commandFromQuery(query map[string]string) *Command {
+	return &Command{
+		User:      query["user"],
+		Source:    query["source"],
+		Command:   query["command"],
+		Arguments: query["args"],
+	}
+}
+
+func httpEventResponse(status int, body any) events.APIGatewayV2HTTPResponse {
+	data, err := json.Marshal(body)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data = []byte(`{"error":"unable to encode response"}`)
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "application/json; charset=utf-8"},
+		Body:       string(data),
+	}
+}
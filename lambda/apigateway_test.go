@@ -0,0 +1,92 @@
+package lambda
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestHandlePayloadHTTPEvent(t *testing.T) {
+	Register(Handler{Name: "testapigw", Func: func(_ context.Context, cmd *Command) (string, error) {
+		return cmd.Source + " " + cmd.Arguments, nil
+	}})
+	defer delete(handlers, "testapigw")
+
+	body := `{"source":"webhook","command":"testapigw","args":"from body"}`
+
+	tests := []struct {
+		name       string
+		event      events.APIGatewayV2HTTPRequest
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			"POST body",
+			httpEvent(http.MethodPost, nil, body, false),
+			http.StatusOK, `"result":"webhook from body"`,
+		},
+		{
+			"POST base64 body",
+			httpEvent(http.MethodPost, nil, base64.StdEncoding.EncodeToString([]byte(body)), true),
+			http.StatusOK, `"result":"webhook from body"`,
+		},
+		{
+			"GET query string",
+			httpEvent(http.MethodGet, map[string]string{"command": "testapigw", "args": "from query", "source": "url"}, "", false),
+			http.StatusOK, `"result":"url from query"`,
+		},
+		{
+			"Unknown command",
+			httpEvent(http.MethodGet, map[string]string{"command": "nosuchcommand"}, "", false),
+			http.StatusNotFound, `"error_code":"unknown_command"`,
+		},
+		{
+			"Invalid body",
+			httpEvent(http.MethodPost, nil, "not json", false),
+			http.StatusBadRequest, `"error"`,
+		},
+		{
+			"Wrong method",
+			httpEvent(http.MethodDelete, nil, "", false),
+			http.StatusMethodNotAllowed, `"error"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, _ := json.Marshal(tt.event)
+
+			res, err := HandlePayload(context.Background(), payload)
+			if err != nil {
+				t.Fatalf("HandlePayload() error = %v", err)
+			}
+
+			response, ok := res.(events.APIGatewayV2HTTPResponse)
+			if !ok {
+				t.Fatalf("HandlePayload() = %#v, want an HTTP response", res)
+			}
+			if response.StatusCode != tt.wantStatus {
+				t.Errorf("StatusCode = %d, want %d", response.StatusCode, tt.wantStatus)
+			}
+			if !strings.Contains(response.Body, tt.wantBody) {
+				t.Errorf("Body = %s, want it to contain %s", response.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func httpEvent(method string, query map[string]string, body string, base64Encoded bool) events.APIGatewayV2HTTPRequest {
+	event := events.APIGatewayV2HTTPRequest{
+		Version:               "2.0",
+		RawPath:               "/",
+		QueryStringParameters: query,
+		Body:                  body,
+		IsBase64Encoded:       base64Encoded,
+	}
+	event.RequestContext.HTTP.Method = method
+	return event
+}
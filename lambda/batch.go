@@ -0,0 +1,89 @@
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/pkg/errors"
+
+	"github.com/lepinkainen/lambdabot/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultBatchConcurrency is how many commands of a batch run at the same time if BATCH_CONCURRENCY isn't set
+const defaultBatchConcurrency = 4
+
+// batchConcurrency returns the BATCH_CONCURRENCY limit, at least one
+func batchConcurrency() int {
+	n := config.Int("BATCH_CONCURRENCY", defaultBatchConcurrency)
+	if n < 1 {
+		return defaultBatchConcurrency
+	}
+	return n
+}
+
+// HandlePayload is the function entry point for raw JSON payloads.
+// It accepts a single Command, an array of Commands, or an API Gateway / Function URL event.
+func HandlePayload(ctx context.Context, payload json.RawMessage) (any, error) {
+	if isHTTPEvent(payload) {
+		var event events.APIGatewayV2HTTPRequest
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, errors.Wrap(err, "Unable to parse HTTP event")
+		}
+		return HandleHTTPEvent(ctx, &event), nil
+	}
+
+	if isJSONArray(payload) {
+		var cmds []*Command
+		if err := json.Unmarshal(payload, &cmds); err != nil {
+			return nil, errors.Wrap(err, "Unable to parse batch")
+		}
+		return HandleBatch(ctx, cmds), nil
+	}
+
+	var cmd Command
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse command")
+	}
+	return HandleRequest(ctx, &cmd)
+}
+
+// isJSONArray reports whether the payload is a JSON array
+func isJSONArray(payload []byte) bool {
+	trimmed := bytes.TrimLeft(payload, " \t\r\n")
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// HandleBatch runs the commands concurrently up to BATCH_CONCURRENCY at a time.
+// The results are in the same order as the commands, a failed command has its Error set.
+func HandleBatch(ctx context.Context, cmds []*Command) []*Command {
+	log.WithContext(ctx).Infof("Handling batch of %d commands", len(cmds))
+
+	results := make([]*Command, len(cmds))
+	sem := make(chan struct{}, batchConcurrency())
+
+	var wg sync.WaitGroup
+	for i, cmd := range cmds {
+		if cmd == nil {
+			cmd = &Command{}
+		}
+
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res, err := HandleRequest(ctx, cmd)
+			if err != nil {
+				res.Error = err.Error()
+			}
+			results[i] = res
+		})
+	}
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,73 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandleBatch(t *testing.T) {
+	t.Setenv("BATCH_CONCURRENCY", "2")
+
+	var running, maxRunning atomic.Int32
+	Register(Handler{Name: "testslow", Func: func(_ context.Context, cmd *Command) (string, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if cmd.Arguments == "fail" {
+			return "", errors.New("failed")
+		}
+		return cmd.Arguments, nil
+	}})
+	defer delete(handlers, "testslow")
+
+	payload := json.RawMessage(` [
+		{"command": "testslow", "args": "1"},
+		{"command": "testslow", "args": "fail"},
+		{"command": "testslow", "args": "3"},
+		{"command": "testslow", "args": "4"},
+		{"command": "testslow", "args": "5"}
+	]`)
+
+	res, err := HandlePayload(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("HandlePayload() error = %v", err)
+	}
+
+	results, ok := res.([]*Command)
+	if !ok || len(results) != 5 {
+		t.Fatalf("HandlePayload() = %#v, want 5 commands", res)
+	}
+
+	for i, want := range []string{"1", "", "3", "4", "5"} {
+		if results[i].Result != want {
+			t.Errorf("results[%d].Result = '%v', want '%v'", i, results[i].Result, want)
+		}
+	}
+	if results[1].Error != "failed" || results[1].ErrorCode != ErrorHandler {
+		t.Errorf("results[1] = %+v, want handler error", results[1])
+	}
+
+	if maxRunning.Load() > 2 {
+		t.Errorf("%d commands ran concurrently, want at most 2", maxRunning.Load())
+	}
+}
+
+func TestHandlePayloadSingle(t *testing.T) {
+	res, err := HandlePayload(context.Background(), json.RawMessage(`{"command": "help", "args": "help"}`))
+	if err != nil {
+		t.Fatalf("HandlePayload() error = %v", err)
+	}
+	if cmd, ok := res.(*Command); !ok || cmd.Result == "" {
+		t.Errorf("HandlePayload() = %#v, want a single command with a result", res)
+	}
+}
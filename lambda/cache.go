@@ -0,0 +1,136 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/cache"
+	"github.com/lepinkainen/lambdabot/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CacheTTL returns how long a result produced at now can be served from the cache
+type CacheTTL func(now time.Time) time.Duration
+
+// FixedTTL caches results for a fixed duration
+func FixedTTL(d time.Duration) CacheTTL {
+	return func(time.Time) time.Duration {
+		return d
+	}
+}
+
+// UntilNext caches results until the next full interval, e.g. UntilNext(time.Hour) expires at the top of the hour
+func UntilNext(interval time.Duration) CacheTTL {
+	return func(now time.Time) time.Duration {
+		return now.Truncate(interval).Add(interval).Sub(now)
+	}
+}
+
+var (
+	cacheMu    sync.Mutex
+	cacheStore cache.Store
+)
+
+// SetCache replaces the store used for cached responses
+func SetCache(store cache.Store) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	cacheStore = store
+}
+
+// responseCache returns the configured store, defaulting to Redis with an in-memory fallback.
+// Returns nil if caching is disabled with CACHE_DISABLED.
+func responseCache() cache.Store {
+	if config.IsSet("CACHE_DISABLED") {
+		return nil
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if cacheStore == nil {
+		if client := RedisClient(); client != nil {
+			cacheStore = cache.WithFallback(cache.NewRedisStore(client), cache.NewMemoryStore())
+		} else {
+			cacheStore = cache.NewMemoryStore()
+		}
+	}
+	return cacheStore
+}
+
+// cachedResponse is what gets stored in the cache for a command
+type cachedResponse struct {
+	Result string       `json:"result"`
+	Lines  []ResultLine `json:"lines,omitempty"`
+}
+
+// cacheKey is the handler name and the arguments lowercased with whitespace collapsed,
+// aliases share the same entries. CacheVary keeps separate entries for different askers.
+func cacheKey(h *Handler, cmd *Command) string {
+	args := strings.Join(strings.Fields(strings.ToLower(cmd.Arguments)), " ")
+	if h.CacheVary != nil {
+		if vary := h.CacheVary(cmd); vary != "" {
+			return h.Name + "[" + vary + "]:" + args
+		}
+	}
+	return h.Name + ":" + args
+}
+
+// cacheGet fills the command result from the cache, returns false on a miss
+func cacheGet(ctx context.Context, h *Handler, cmd *Command) bool {
+	store := responseCache()
+	if h.CacheTTL == nil || store == nil {
+		return false
+	}
+
+	key := cacheKey(h, cmd)
+	logger := log.WithContext(ctx).WithField("cache_key", key)
+
+	value, ok, err := store.Get(ctx, key)
+	if err != nil {
+		logger.Warnf("Cache get failed: %v", err)
+		return false
+	}
+	if !ok {
+		logger.WithField("cache", "miss").Info("Cache miss")
+		return false
+	}
+
+	var cached cachedResponse
+	if err := json.Unmarshal(value, &cached); err != nil {
+		logger.Warnf("Unable to unmarshal cached response: %v", err)
+		return false
+	}
+
+	logger.WithField("cache", "hit").Info("Cache hit")
+	cmd.Lines = cached.Lines
+	cmd.Result = cached.Result
+	return true
+}
+
+// cacheSet stores a successful command result
+func cacheSet(ctx context.Context, h *Handler, cmd *Command) {
+	store := responseCache()
+	if h.CacheTTL == nil || store == nil || cmd.Result == "" {
+		return
+	}
+
+	ttl := h.CacheTTL(time.Now())
+	if ttl <= 0 {
+		return
+	}
+
+	value, err := json.Marshal(cachedResponse{Result: cmd.Result, Lines: cmd.Lines})
+	if err != nil {
+		log.WithContext(ctx).Warnf("Unable to marshal response for cache: %v", err)
+		return
+	}
+
+	if err := store.Set(ctx, cacheKey(h, cmd), value, ttl); err != nil {
+		log.WithContext(ctx).Warnf("Cache set failed: %v", err)
+	}
+}
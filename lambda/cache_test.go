@@ -0,0 +1,108 @@
+package lambda
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/cache"
+)
+
+func TestHandleRequestCache(t *testing.T) {
+	SetCache(cache.NewMemoryStore())
+	defer SetCache(nil)
+
+	calls := 0
+	Register(Handler{
+		Name:     "testcached",
+		Aliases:  []string{"testcachedalias"},
+		CacheTTL: FixedTTL(time.Hour),
+		Func: func(_ context.Context, cmd *Command) (string, error) {
+			calls++
+			cmd.AddLine(ResultLine{Text: cmd.Arguments, URL: "https://example.com"})
+			return "", nil
+		},
+	})
+	defer func() {
+		delete(handlers, "testcached")
+		delete(handlers, "testcachedalias")
+	}()
+
+	for _, cmd := range []*Command{
+		{Command: "testcached", Arguments: "Some  Show"},
+		{Command: "testcached", Arguments: "some show"},
+		{Command: "testcachedalias", Arguments: " SOME show "},
+	} {
+		got, err := HandleRequest(context.Background(), cmd)
+		if err != nil {
+			t.Fatalf("HandleRequest() error = %v", err)
+		}
+		if got.Result != "Some  Show" || len(got.Lines) != 1 || got.Lines[0].URL != "https://example.com" {
+			t.Errorf("Result = '%v', Lines = %+v, want the first response", got.Result, got.Lines)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+
+	if _, err := HandleRequest(context.Background(), &Command{Command: "testcached", Arguments: "other show"}); err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2 after different arguments", calls)
+	}
+}
+
+func TestHandleRequestCacheVary(t *testing.T) {
+	SetCache(cache.NewMemoryStore())
+	defer SetCache(nil)
+
+	calls := 0
+	Register(Handler{
+		Name:     "testvary",
+		CacheTTL: FixedTTL(time.Hour),
+		// only nick gets a personal result, everyone else shares one
+		CacheVary: func(cmd *Command) string {
+			if cmd.User == "nick" {
+				return "nick"
+			}
+			return ""
+		},
+		Func: func(_ context.Context, cmd *Command) (string, error) {
+			calls++
+			if cmd.User == "nick" {
+				return "personal", nil
+			}
+			return "shared", nil
+		},
+	})
+	defer delete(handlers, "testvary")
+
+	tests := []struct {
+		user      string
+		want      string
+		wantCalls int
+	}{
+		{"other", "shared", 1},
+		{"nick", "personal", 2},
+		{"third", "shared", 2},
+		{"nick", "personal", 2},
+	}
+	for _, tt := range tests {
+		got, err := HandleRequest(context.Background(), &Command{User: tt.user, Command: "testvary"})
+		if err != nil {
+			t.Fatalf("HandleRequest() error = %v", err)
+		}
+		if got.Result != tt.want || calls != tt.wantCalls {
+			t.Errorf("HandleRequest() for %s = '%v' after %d calls, want '%v' after %d", tt.user, got.Result, calls, tt.want, tt.wantCalls)
+		}
+	}
+}
+
+func TestUntilNext(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 45, 30, 0, time.UTC)
+	if got := UntilNext(time.Hour)(now); got != 14*time.Minute+30*time.Second {
+		t.Errorf("UntilNext(time.Hour) = %v, want 14m30s", got)
+	}
+}
@@ -0,0 +1,39 @@
+package lambda
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHandleRequestNotConfigured(t *testing.T) {
+	called := false
+	Register(Handler{
+		Name:     "testpaid",
+		Requires: []string{"TEST_PAID_API_KEY"},
+		Func: func(context.Context, *Command) (string, error) {
+			called = true
+			return "answer", nil
+		},
+	})
+	defer delete(handlers, "testpaid")
+
+	got, err := HandleRequest(context.Background(), &Command{Command: "testpaid"})
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if called || got.ErrorCode != ErrorNotConfigured || got.Result != "testpaid is not configured" {
+		t.Errorf("Result = '%v', ErrorCode = '%v', want not configured without running the handler", got.Result, got.ErrorCode)
+	}
+
+	help, _ := HandleRequest(context.Background(), &Command{Command: "help"})
+	if strings.Contains(help.Result, "testpaid") {
+		t.Errorf("help lists an unconfigured command: %v", help.Result)
+	}
+
+	t.Setenv("TEST_PAID_API_KEY", "key")
+	got, _ = HandleRequest(context.Background(), &Command{Command: "testpaid"})
+	if !called || got.Result != "answer" {
+		t.Errorf("Result = '%v', want the handler to run once configured", got.Result)
+	}
+}
@@ -0,0 +1,97 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lepinkainen/lambdabot/role"
+)
+
+// Help lists all commands grouped by category, or shows detailed usage for a single command
+func Help(ctx context.Context, cmd *Command) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(cmd.Arguments))
+	if name == "" {
+		return helpListing(ctx, cmd), nil
+	}
+
+	// commands disabled in the source are as unknown here as they are when run
+	handler, ok := Lookup(name)
+	if !ok || !allowedBy(loadPolicyRules(ctx), handler, cmd.Source) {
+		return fmt.Sprintf("Unknown command: %s", name), nil
+	}
+
+	return helpDetails(handler), nil
+}
+
+// helpListing formats the commands available in the source as "category: cmd1, cmd2 | category: cmd3"
+func helpListing(ctx context.Context, cmd *Command) string {
+	var (
+		groups     []string
+		category   string
+		names      []string
+		rules      = loadPolicyRules(ctx)
+		callerRole = userRole(ctx, cmd)
+	)
+
+	for _, h := range Handlers() {
+		// commands that would only answer "not configured" aren't worth listing
+		if len(h.MissingConfig()) > 0 {
+			continue
+		}
+		if !allowedBy(rules, h, cmd.Source) || callerRole < h.MinRole {
+			continue
+		}
+		if h.Category != category && len(names) > 0 {
+			groups = append(groups, fmt.Sprintf("%s: %s", category, strings.Join(names, ", ")))
+			names = nil
+		}
+		category = h.Category
+		names = append(names, h.Name)
+	}
+	if len(names) > 0 {
+		groups = append(groups, fmt.Sprintf("%s: %s", category, strings.Join(names, ", ")))
+	}
+
+	return fmt.Sprintf("Commands: %s | Use 'help <command>' for details", strings.Join(groups, " | "))
+}
+
+// helpDetails formats the summary, usage, aliases and examples of a single command
+func helpDetails(h *Handler) string {
+	parts := []string{h.Name}
+	if h.Summary != "" {
+		parts[0] = fmt.Sprintf("%s: %s", h.Name, h.Summary)
+	}
+
+	usage := h.Usage
+	if usage == "" {
+		usage = h.Name
+	}
+	parts = append(parts, "Usage: "+usage)
+
+	if len(h.Aliases) > 0 {
+		parts = append(parts, "Aliases: "+strings.Join(h.Aliases, ", "))
+	}
+	if len(h.Examples) > 0 {
+		parts = append(parts, "Examples: "+strings.Join(h.Examples, "; "))
+	}
+	if h.MinRole > role.Normal {
+		parts = append(parts, "Requires: "+h.MinRole.String())
+	}
+	if len(h.MissingConfig()) > 0 {
+		parts = append(parts, "Not configured")
+	}
+
+	return strings.Join(parts, " | ")
+}
+
+func init() {
+	Register(Handler{
+		Name:     "help",
+		Summary:  "List commands or show usage for one command",
+		Usage:    "help [command]",
+		Examples: []string{"help", "help weather"},
+		Category: "general",
+		Func:     Help,
+	})
+}
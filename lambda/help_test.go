@@ -0,0 +1,99 @@
+package lambda
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lepinkainen/lambdabot/policy"
+)
+
+func TestHelp(t *testing.T) {
+	Register(Handler{
+		Name:     "testweather",
+		Aliases:  []string{"testforecast"},
+		Summary:  "Current weather",
+		Usage:    "testweather [location]",
+		Examples: []string{"testweather Tampere"},
+		Category: "weather",
+		Func:     func(context.Context, *Command) (string, error) { return "", nil },
+	})
+	defer func() {
+		delete(handlers, "testweather")
+		delete(handlers, "testforecast")
+	}()
+
+	tests := []struct {
+		name string
+		args string
+		want []string
+	}{
+		{"Listing", "", []string{"Commands:", "general: help", "weather: testweather"}},
+		{"Details", "testweather", []string{"testweather: Current weather", "Usage: testweather [location]", "Aliases: testforecast", "Examples: testweather Tampere"}},
+		{"Alias details", "testforecast", []string{"testweather: Current weather"}},
+		{"Unknown", "nosuchcommand", []string{"Unknown command: nosuchcommand"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HandleRequest(context.Background(), &Command{Command: "help", Arguments: tt.args})
+			if err != nil {
+				t.Fatalf("Help() error = %v", err)
+			}
+			for _, part := range tt.want {
+				if !strings.Contains(got.Result, part) {
+					t.Errorf("Help() = '%v', want it to contain '%v'", got.Result, part)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlersListsAliasesOnce(t *testing.T) {
+	Register(Handler{
+		Name:    "testaliased",
+		Aliases: []string{"testalias1", "testalias2"},
+		Func:    func(context.Context, *Command) (string, error) { return "", nil },
+	})
+	defer func() {
+		delete(handlers, "testaliased")
+		delete(handlers, "testalias1")
+		delete(handlers, "testalias2")
+	}()
+
+	count := 0
+	for _, h := range Handlers() {
+		if h.Name == "testaliased" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("Handlers() listed testaliased %d times, want 1", count)
+	}
+
+	if h, ok := Lookup("testalias2"); !ok || h.Name != "testaliased" {
+		t.Errorf("Lookup(testalias2) = %v, %v, want testaliased", h, ok)
+	}
+}
+
+func TestHelpDetailsPolicy(t *testing.T) {
+	SetPolicyStore(policy.NewMemoryStore())
+	defer SetPolicyStore(nil)
+	t.Setenv("POLICY_RULES", `[{"source": "#quiet", "command": "testhidden", "allow": false}]`)
+
+	Register(Handler{Name: "testhidden", Summary: "Hidden in #quiet", Func: func(context.Context, *Command) (string, error) { return "", nil }})
+	defer delete(handlers, "testhidden")
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"#quiet", "Unknown command: testhidden"},
+		{"#other", "testhidden: Hidden in #quiet"},
+	}
+	for _, tt := range tests {
+		got, _ := HandleRequest(context.Background(), &Command{Source: tt.source, Command: "help", Arguments: "testhidden"})
+		if !strings.Contains(got.Result, tt.want) {
+			t.Errorf("Help() in %s = '%v', want it to contain '%v'", tt.source, got.Result, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRequestBody limits the size of command payloads accepted over HTTP
+const maxRequestBody = 1 << 20
+
+// NewHTTPHandler returns a handler serving POST /command with the same JSON payloads
+// as the Lambda function, and GET /health for liveness checks.
+// Every command gets at most timeout to finish.
+func NewHTTPHandler(timeout time.Duration) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	mux.HandleFunc("POST /command", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(extractTrace(r.Context(), propagation.HeaderCarrier(r.Header)), timeout)
+		defer cancel()
+
+		payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+			return
+		}
+
+		status, body := handleHTTPPayload(ctx, payload)
+		writeJSON(w, status, body)
+	})
+
+	return mux
+}
+
+// handleHTTPPayload runs a single command or a batch and picks the HTTP status for the response
+func handleHTTPPayload(ctx context.Context, payload []byte) (int, any) {
+	if !json.Valid(payload) {
+		return http.StatusBadRequest, map[string]string{"error": "invalid JSON payload"}
+	}
+
+	res, err := HandlePayload(ctx, payload)
+	if err != nil {
+		cmd, ok := res.(*Command)
+		if !ok || cmd == nil {
+			return http.StatusBadRequest, map[string]string{"error": err.Error()}
+		}
+		cmd.Error = err.Error()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return http.StatusGatewayTimeout, cmd
+		}
+	}
+
+	if cmd, ok := res.(*Command); ok {
+		return StatusCode(cmd), cmd
+	}
+	return http.StatusOK, res
+}
+
+// StatusCode maps the error code of a handled command to an HTTP status
+func StatusCode(cmd *Command) int {
+	switch cmd.ErrorCode {
+	case "":
+		return http.StatusOK
+	case ErrorUnknownCommand:
+		return http.StatusNotFound
+	case ErrorDisabled, ErrorBanned, ErrorForbidden:
+		return http.StatusForbidden
+	case ErrorRateLimited:
+		return http.StatusTooManyRequests
+	case ErrorNotConfigured:
+		return http.StatusServiceUnavailable
+	case ErrorHandler:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Warnf("Unable to write HTTP response: %v", err)
+	}
+}
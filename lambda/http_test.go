@@ -0,0 +1,65 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	Register(Handler{Name: "testhttp", Func: func(_ context.Context, cmd *Command) (string, error) {
+		return cmd.User + ": " + cmd.Arguments, nil
+	}})
+	Register(Handler{Name: "testhttpslow", Func: func(ctx context.Context, _ *Command) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}})
+	defer func() {
+		delete(handlers, "testhttp")
+		delete(handlers, "testhttpslow")
+	}()
+
+	server := httptest.NewServer(NewHTTPHandler(50 * time.Millisecond))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"Health", http.MethodGet, "/health", "", http.StatusOK, `"status":"ok"`},
+		{"Command", http.MethodPost, "/command", `{"user":"nick","command":"testhttp","args":"hello"}`, http.StatusOK, `"result":"nick: hello"`},
+		{"Batch", http.MethodPost, "/command", `[{"command":"testhttp","args":"a"},{"command":"testhttp","args":"b"}]`, http.StatusOK, `"result":": b"`},
+		{"Unknown command", http.MethodPost, "/command", `{"command":"nosuchcommand"}`, http.StatusNotFound, `"error_code":"unknown_command"`},
+		{"Timeout", http.MethodPost, "/command", `{"command":"testhttpslow"}`, http.StatusGatewayTimeout, `"error":"context deadline exceeded"`},
+		{"Invalid JSON", http.MethodPost, "/command", `{"command":`, http.StatusBadRequest, `"error":"invalid JSON payload"`},
+		{"Wrong method", http.MethodGet, "/command", "", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequestWithContext(context.Background(), tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+
+			var body json.RawMessage
+			_ = json.NewDecoder(res.Body).Decode(&body)
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", body, tt.wantBody)
+			}
+		})
+	}
+}
@@ -2,13 +2,12 @@ package lambda
 
 import (
 	"context"
+	"fmt"
 	"os"
 
-	log "github.com/sirupsen/logrus"
-)
+	"github.com/lepinkainen/lambdabot/role"
 
-var (
-	handlerFunctions = make(map[string]func(string) (string, error))
+	log "github.com/sirupsen/logrus"
 )
 
 // Command is the query and response to commands
@@ -17,36 +16,125 @@ type Command struct {
 	Source    string `json:"source"`
 	Command   string `json:"command"`
 	Arguments string `json:"args"`
-	Result    string `json:"result"`
+	// Format is the markup of the result, e.g. "slack", picked from the source if empty
+	Format string `json:"format,omitempty"`
+	Result string `json:"result"`
+	// Messages is the result split to fit the message limit of the source, Result is the first of them
+	Messages []string `json:"messages,omitempty"`
+	// Lines is the result as an ordered list of lines, Result has the same content on one line
+	Lines []ResultLine `json:"lines,omitempty"`
+	// ErrorCode is a machine-readable reason for a failed or empty result
+	ErrorCode string `json:"error_code,omitempty"`
+	// Error is the handler error of a command run as part of a batch
+	Error string `json:"error,omitempty"`
+
+	// cacheHit is set when the result was served from the cache
+	cacheHit bool
 }
 
 type handlerFunc func(string) (string, error)
 
+// HandlerFunc is a context-aware handler that receives the whole command.
+// The context carries the Lambda deadline and should be passed on to any outbound calls.
+type HandlerFunc func(ctx context.Context, cmd *Command) (string, error)
+
+// ArgsHandler adapts a handler that only needs the context and the command arguments
+func ArgsHandler(function func(context.Context, string) (string, error)) HandlerFunc {
+	return func(ctx context.Context, cmd *Command) (string, error) {
+		return function(ctx, cmd.Arguments)
+	}
+}
+
 // RegisterHandler adds the given url parser and command to the map of handlers
 func RegisterHandler(command string, function handlerFunc) {
-	handlerFunctions[command] = function
+	RegisterContextHandler(command, func(_ context.Context, cmd *Command) (string, error) {
+		return function(cmd.Arguments)
+	})
+}
+
+// RegisterContextHandler adds a context-aware handler for the given command
+func RegisterContextHandler(command string, function HandlerFunc) {
+	Register(Handler{Name: command, Func: function})
 }
 
 // HandleRequest is the function entry point
-func HandleRequest(_ context.Context, cmd *Command) (*Command, error) {
+func HandleRequest(ctx context.Context, cmd *Command) (*Command, error) {
+	return withTracing(ctx, cmd, func(ctx context.Context, cmd *Command) (*Command, error) {
+		res, err := withMetrics(ctx, cmd, dispatch)
+		renderResult(cmd)
+		return res, err
+	})
+}
 
-	log.Infof("Handling %v", cmd)
+// dispatch checks the user, policies, cache and limits before running the handler of the command
+func dispatch(ctx context.Context, cmd *Command) (*Command, error) {
+	log.WithContext(ctx).Infof("Handling %v", cmd)
 
-	// NOTE: only the first matching command will be run
-	for pattern, handler := range handlerFunctions {
-		// No match, skip
-		if pattern != cmd.Command {
-			continue
-		}
-		log.Infof("Running command %v", cmd)
-		res, err := handler(cmd.Arguments)
-		cmd.Result = res
-		return cmd, err
+	callerRole := userRole(ctx, cmd)
+	if callerRole == role.Banned {
+		// Banned users get no reply at all, not even suggestions
+		log.WithContext(ctx).Infof("Ignoring banned user %s in %s", cmd.User, cmd.Source)
+		cmd.ErrorCode = ErrorBanned
+		return cmd, nil
 	}
 
-	// No handler matched, empty result
-	// cmd.Result = fmt.Sprintf("Unknown command: %s", cmd.Command)
-	return cmd, nil
+	handler, ok := Lookup(cmd.Command)
+	if !ok {
+		// No handler matched, suggest close matches or stay silent
+		cmd.ErrorCode = ErrorUnknownCommand
+		cmd.setResult(unknownCommandResponse(ctx, cmd))
+		return cmd, nil
+	}
+
+	if !commandAllowed(ctx, handler, cmd) {
+		// Disabled commands stay quiet like unknown ones
+		log.WithContext(ctx).Infof("Command %s is not allowed in %s", handler.Name, cmd.Source)
+		cmd.ErrorCode = ErrorDisabled
+		return cmd, nil
+	}
+
+	if callerRole < handler.MinRole {
+		log.WithContext(ctx).Infof("Command %s needs role %s, %s is %s", handler.Name, handler.MinRole, cmd.User, callerRole)
+		cmd.ErrorCode = ErrorForbidden
+		cmd.setResult(fmt.Sprintf("%s is limited to %s users", handler.Name, handler.MinRole))
+		return cmd, nil
+	}
+
+	if missing := handler.MissingConfig(); len(missing) > 0 {
+		log.WithContext(ctx).Warnf("Command %s is missing configuration: %v", handler.Name, missing)
+		cmd.ErrorCode = ErrorNotConfigured
+		cmd.setResult(fmt.Sprintf("%s is not configured", handler.Name))
+		return cmd, nil
+	}
+
+	// cached answers cost nothing, so they don't use up the rate limit
+	if cacheGet(ctx, handler, cmd) {
+		cmd.cacheHit = true
+		return cmd, nil
+	}
+
+	if reply, ok := checkRateLimit(ctx, handler, cmd); !ok {
+		cmd.ErrorCode = ErrorRateLimited
+		cmd.setResult(reply)
+		return cmd, nil
+	}
+
+	log.WithContext(ctx).Infof("Running command %v", cmd)
+	res, err := runHandler(ctx, handler, cmd)
+	if err != nil {
+		cmd.ErrorCode = ErrorHandler
+	}
+	if cmd.ErrorCode == ErrorPanic {
+		// the friendly error isn't worth caching
+		cmd.setResult(res)
+		return cmd, nil
+	}
+	cmd.setResult(res)
+
+	if err == nil {
+		cacheSet(ctx, handler, cmd)
+	}
+	return cmd, err
 }
 
 func init() {
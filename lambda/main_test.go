@@ -0,0 +1,68 @@
+package lambda
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHandleRequestContextHandler(t *testing.T) {
+	RegisterContextHandler("whoami", func(ctx context.Context, cmd *Command) (string, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return "no deadline", nil
+		}
+		return cmd.User + "@" + cmd.Source, nil
+	})
+	defer delete(handlers, "whoami")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	got, err := HandleRequest(ctx, &Command{User: "nick", Source: "#channel", Command: "whoami"})
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if got.Result != "nick@#channel" {
+		t.Errorf("HandleRequest() = '%v', want 'nick@#channel'", got.Result)
+	}
+}
+
+func TestHandleRequestStringHandler(t *testing.T) {
+	RegisterHandler("upper", func(args string) (string, error) {
+		return "got " + args, nil
+	})
+	defer delete(handlers, "upper")
+
+	got, err := HandleRequest(context.Background(), &Command{Command: "upper", Arguments: "this"})
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if got.Result != "got this" {
+		t.Errorf("HandleRequest() = '%v', want 'got this'", got.Result)
+	}
+}
+
+func TestHandleRequestUnknownCommand(t *testing.T) {
+	got, err := HandleRequest(context.Background(), &Command{Command: "nosuchcommand"})
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if got.Result != "" {
+		t.Errorf("HandleRequest() = '%v', want empty result", got.Result)
+	}
+}
+
+func TestHandleRequestCommandCase(t *testing.T) {
+	RegisterHandler("upper", func(args string) (string, error) {
+		return "got " + args, nil
+	})
+	defer delete(handlers, "upper")
+
+	got, err := HandleRequest(context.Background(), &Command{Command: "UPPER", Arguments: "this"})
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if got.Result != "got this" {
+		t.Errorf("HandleRequest() = '%v', want 'got this'", got.Result)
+	}
+}
@@ -0,0 +1,146 @@
+package lambda
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// unknownCommandMetric is the command dimension of unknown commands, so typos don't create new metrics
+const unknownCommandMetric = "unknown"
+
+var (
+	metricsMu      sync.Mutex
+	metricsEmitter *metrics.Emitter
+	metricsInit    bool
+
+	// coldStart is true until the first command of this Lambda instance has been handled
+	coldStart atomic.Bool
+)
+
+func init() {
+	coldStart.Store(true)
+
+	config.Register(config.Setting{Key: "METRICS_DISABLED", Description: "Set to disable CloudWatch EMF metrics"})
+	config.Register(config.Setting{Key: "METRICS_FILE", Description: "Append EMF metrics to this file instead of stdout, for local runs"})
+	config.Register(config.Setting{Key: "METRICS_NAMESPACE", Description: "CloudWatch namespace of the metrics, default Lambdabot"})
+}
+
+// SetMetrics replaces the emitter for metrics, nil goes back to the configured one
+func SetMetrics(emitter *metrics.Emitter) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metricsEmitter = emitter
+	metricsInit = emitter != nil
+}
+
+// metricsOutput returns the configured emitter, writing to METRICS_FILE or stdout.
+// Returns nil if metrics are disabled with METRICS_DISABLED or the file can't be opened.
+func metricsOutput() *metrics.Emitter {
+	if config.IsSet("METRICS_DISABLED") {
+		return nil
+	}
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	if !metricsInit {
+		metricsInit = true
+
+		namespace := config.Get("METRICS_NAMESPACE")
+		if namespace == "" {
+			namespace = "Lambdabot"
+		}
+
+		if path := config.Get("METRICS_FILE"); path != "" {
+			f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+			if err != nil {
+				log.Warnf("Unable to open metrics file, metrics disabled: %v", err)
+				return nil
+			}
+			metricsEmitter = metrics.New(f, namespace)
+		} else {
+			metricsEmitter = metrics.New(os.Stdout, namespace)
+		}
+	}
+	return metricsEmitter
+}
+
+// recordMetrics writes the invocation, latency, error, cache hit and upstream latency of a handled command
+func recordMetrics(ctx context.Context, cmd *Command, elapsed time.Duration, upstream *metrics.Upstream) {
+	cold := coldStart.Swap(false)
+
+	emitter := metricsOutput()
+	if emitter == nil {
+		return
+	}
+
+	command := unknownCommandMetric
+	if h, ok := Lookup(cmd.Command); ok {
+		command = h.Name
+	}
+
+	failed := 0.0
+	if cmd.ErrorCode == ErrorHandler || cmd.ErrorCode == ErrorPanic {
+		failed = 1
+	}
+
+	hit := 0.0
+	if cmd.cacheHit {
+		hit = 1
+	}
+
+	record := metrics.Record{
+		Dimensions:    map[string]string{"Command": command, "Source": cmd.Source},
+		DimensionSets: [][]string{{"Command", "Source"}, {"Command"}},
+		Properties:    map[string]any{"ColdStart": cold, "ErrorCode": cmd.ErrorCode},
+		Metrics: []metrics.Metric{
+			{Name: "Invocations", Unit: metrics.Count, Value: 1},
+			{Name: "Latency", Unit: metrics.Milliseconds, Value: milliseconds(elapsed)},
+			{Name: "Errors", Unit: metrics.Count, Value: failed},
+			{Name: "CacheHits", Unit: metrics.Count, Value: hit},
+			{Name: "UpstreamLatency", Unit: metrics.Milliseconds, Value: milliseconds(upstream.Total())},
+		},
+	}
+	if err := emitter.Emit(record); err != nil {
+		log.WithContext(ctx).Warnf("Unable to write metrics: %v", err)
+	}
+
+	// every service gets its own latency, aggregated over all commands that call it
+	for service, stats := range upstream.Services() {
+		err := emitter.Emit(metrics.Record{
+			Dimensions:    map[string]string{"Service": service},
+			DimensionSets: [][]string{{"Service"}},
+			Properties:    map[string]any{"Command": command},
+			Metrics: []metrics.Metric{
+				{Name: "UpstreamCalls", Unit: metrics.Count, Value: float64(stats.Calls)},
+				{Name: "UpstreamLatency", Unit: metrics.Milliseconds, Value: milliseconds(stats.Duration)},
+			},
+		})
+		if err != nil {
+			log.WithContext(ctx).Warnf("Unable to write metrics: %v", err)
+		}
+	}
+}
+
+// withMetrics collects upstream calls while running the dispatcher and records the metrics afterwards
+func withMetrics(ctx context.Context, cmd *Command, dispatch func(context.Context, *Command) (*Command, error)) (*Command, error) {
+	start := time.Now()
+	ctx, upstream := metrics.WithUpstream(ctx)
+
+	res, err := dispatch(ctx, cmd)
+
+	recordMetrics(ctx, cmd, time.Since(start), upstream)
+	return res, err
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,103 @@
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/cache"
+	"github.com/lepinkainen/lambdabot/metrics"
+)
+
+func TestHandleRequestMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	SetMetrics(metrics.New(&buf, "Test"))
+	defer SetMetrics(nil)
+
+	RegisterContextHandler("slow", func(ctx context.Context, cmd *Command) (string, error) {
+		metrics.RecordUpstream(ctx, "api", 25*time.Millisecond)
+		if cmd.Arguments == "fail" {
+			return "", errors.New("upstream down")
+		}
+		return "done", nil
+	})
+	defer delete(handlers, "slow")
+
+	_, _ = HandleRequest(context.Background(), &Command{Source: "#channel", Command: "slow"})
+	_, _ = HandleRequest(context.Background(), &Command{Source: "#channel", Command: "slow", Arguments: "fail"})
+	_, _ = HandleRequest(context.Background(), &Command{Source: "#channel", Command: "nosuchcommand"})
+
+	var records []map[string]any
+	for line := range strings.Lines(buf.String()) {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid EMF record '%v': %v", line, err)
+		}
+		records = append(records, record)
+	}
+
+	// a command record and a service record for both runs of slow, one record for the unknown command
+	if len(records) != 5 {
+		t.Fatalf("HandleRequest() wrote %d records, want 5", len(records))
+	}
+
+	tests := []struct {
+		record int
+		key    string
+		want   any
+	}{
+		{0, "Command", "slow"},
+		{0, "Source", "#channel"},
+		{0, "Invocations", 1.0},
+		{0, "Errors", 0.0},
+		{0, "UpstreamLatency", 25.0},
+		{1, "Service", "api"},
+		{1, "UpstreamCalls", 1.0},
+		{2, "Errors", 1.0},
+		{2, "ErrorCode", ErrorHandler},
+		{4, "Command", unknownCommandMetric},
+		{4, "ColdStart", false},
+	}
+	for _, tt := range tests {
+		if got := records[tt.record][tt.key]; got != tt.want {
+			t.Errorf("record %d %s = '%v', want '%v'", tt.record, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestHandleRequestMetricsCacheHit(t *testing.T) {
+	var buf bytes.Buffer
+	SetMetrics(metrics.New(&buf, "Test"))
+	defer SetMetrics(nil)
+	SetCache(cache.NewMemoryStore())
+	defer SetCache(nil)
+
+	Register(Handler{
+		Name:     "testcachedmetrics",
+		CacheTTL: FixedTTL(time.Hour),
+		Func:     func(context.Context, *Command) (string, error) { return "done", nil },
+	})
+	defer delete(handlers, "testcachedmetrics")
+
+	for range 2 {
+		_, _ = HandleRequest(context.Background(), &Command{Source: "#channel", Command: "testcachedmetrics"})
+	}
+
+	var hits []any
+	for line := range strings.Lines(buf.String()) {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid EMF record '%v': %v", line, err)
+		}
+		hits = append(hits, record["CacheHits"])
+	}
+
+	want := []any{0.0, 1.0}
+	if len(hits) != len(want) || hits[0] != want[0] || hits[1] != want[1] {
+		t.Errorf("CacheHits = '%v', want '%v'", hits, want)
+	}
+}
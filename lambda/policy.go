@@ -0,0 +1,171 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/policy"
+	"github.com/lepinkainen/lambdabot/role"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorDisabled is set as the error code of commands a policy doesn't allow in the source
+const ErrorDisabled = "disabled"
+
+// policyCommand is never subject to policies so admins can't lock themselves out
+const policyCommand = "policy"
+
+var (
+	policyMu    sync.Mutex
+	policyStore policy.Store
+)
+
+// SetPolicyStore replaces the store for rules edited at runtime
+func SetPolicyStore(store policy.Store) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	policyStore = store
+}
+
+// policies returns the configured store, defaulting to Redis when available and memory otherwise
+func policies() policy.Store {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+
+	if policyStore == nil {
+		if client := RedisClient(); client != nil {
+			policyStore = policy.NewRedisStore(client)
+		} else {
+			policyStore = policy.NewMemoryStore()
+		}
+	}
+	return policyStore
+}
+
+// denyAll replaces POLICY_RULES that can't be parsed, so a typo doesn't open up every command everywhere
+var denyAll = policy.Rule{Source: policy.Any, Command: policy.Any, Allow: false}
+
+// policyRules returns the rules from POLICY_RULES followed by the ones edited at runtime,
+// so a runtime rule overrides a configured one for the same source and command.
+// Broken POLICY_RULES deny every command, the runtime rules still apply on top.
+func policyRules(ctx context.Context) ([]policy.Rule, error) {
+	rules, parseErr := policy.Parse(config.Get("POLICY_RULES"))
+	if parseErr != nil {
+		rules = []policy.Rule{denyAll}
+	}
+
+	stored, err := policies().Load(ctx)
+	if err != nil {
+		return rules, errors.Join(parseErr, err)
+	}
+	return append(rules, stored...), parseErr
+}
+
+// commandAllowed checks the policies for the handler in the source of the command.
+// A broken rule store is logged and only the configured rules are used, broken POLICY_RULES deny everything but policy.
+func commandAllowed(ctx context.Context, h *Handler, cmd *Command) bool {
+	return allowedBy(loadPolicyRules(ctx), h, cmd.Source)
+}
+
+// loadPolicyRules returns the rules in effect, logging store errors
+func loadPolicyRules(ctx context.Context) []policy.Rule {
+	rules, err := policyRules(ctx)
+	if err != nil {
+		log.WithContext(ctx).Warnf("Unable to load policy rules: %v", err)
+	}
+	return rules
+}
+
+// allowedBy evaluates already loaded rules for the handler in the source
+func allowedBy(rules []policy.Rule, h *Handler, source string) bool {
+	return h.Name == policyCommand || policy.Allowed(rules, source, h.Name)
+}
+
+// Policy lists and edits the per-source command rules, changing them is limited to admins
+func Policy(ctx context.Context, cmd *Command) (string, error) {
+	args := strings.Fields(cmd.Arguments)
+	if len(args) == 0 || args[0] == "list" {
+		// the rules in effect, broken POLICY_RULES show up as the deny * * that replaced them
+		rules := loadPolicyRules(ctx)
+		if len(args) > 1 {
+			rules = slices.DeleteFunc(rules, func(r policy.Rule) bool {
+				return r.Source != args[1] && r.Source != policy.Any
+			})
+		}
+		if len(rules) == 0 {
+			return "No policy rules, every command is allowed everywhere", nil
+		}
+
+		texts := make([]string, len(rules))
+		for i, r := range rules {
+			texts[i] = r.String()
+		}
+		return strings.Join(texts, resultSeparator), nil
+	}
+
+	if userRole(ctx, cmd) < role.Admin {
+		return "Only admins can change policies", nil
+	}
+	if len(args) != 3 {
+		return "Usage: policy allow|deny|clear <source|here|*> <command|*>", nil
+	}
+
+	action, source, name := args[0], args[1], strings.ToLower(args[2])
+	if source == "here" {
+		source = cmd.Source
+	}
+	if name != policy.Any {
+		h, ok := Lookup(name)
+		if !ok {
+			return fmt.Sprintf("Unknown command: %s", name), nil
+		}
+		name = h.Name
+	}
+
+	var edit func(rules []policy.Rule) []policy.Rule
+	switch action {
+	case "allow", "deny":
+		edit = func(rules []policy.Rule) []policy.Rule {
+			return policy.Set(rules, policy.Rule{Source: source, Command: name, Allow: action == "allow"})
+		}
+	case "clear":
+		edit = func(rules []policy.Rule) []policy.Rule {
+			return policy.Remove(rules, source, name)
+		}
+	default:
+		return fmt.Sprintf("Unknown policy action: %s", action), nil
+	}
+
+	if err := policies().Update(ctx, edit); err != nil {
+		return "", err
+	}
+
+	log.WithContext(ctx).WithField("user", cmd.User).Infof("Policy %s %s %s", action, source, name)
+	return fmt.Sprintf("Policy updated: %s %s %s", action, source, name), nil
+}
+
+func init() {
+	config.Register(config.Setting{
+		Key:         "POLICY_RULES",
+		Description: `JSON list of command rules, e.g. [{"source": "*", "command": "wa", "allow": false}]`,
+		Validate: func(value string) error {
+			_, err := policy.Parse(value)
+			return err
+		},
+	})
+
+	Register(Handler{
+		Name:     policyCommand,
+		Summary:  "List or edit which commands are allowed in which sources",
+		Usage:    "policy [list [source]] | policy allow|deny|clear <source|here|*> <command|*>",
+		Examples: []string{"policy list #channel", "policy deny * wa", "policy allow here wa"},
+		Category: "admin",
+		Func:     Policy,
+	})
+}
@@ -0,0 +1,109 @@
+package lambda
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lepinkainen/lambdabot/policy"
+)
+
+func TestHandleRequestPolicy(t *testing.T) {
+	SetPolicyStore(policy.NewMemoryStore())
+	defer SetPolicyStore(nil)
+	t.Setenv("POLICY_RULES", `[{"source": "*", "command": "paid", "allow": false}, {"source": "#paid", "command": "paid", "allow": true}]`)
+	t.Setenv("ADMIN_USERS", "#random:admin")
+
+	RegisterHandler("paid", func(args string) (string, error) {
+		return "expensive", nil
+	})
+	defer delete(handlers, "paid")
+
+	tests := []struct {
+		name   string
+		source string
+		want   string
+		code   string
+	}{
+		{"denied everywhere", "#random", "", ErrorDisabled},
+		{"allowed in source", "#paid", "expensive", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := HandleRequest(context.Background(), &Command{Source: tt.source, Command: "paid"})
+			if got.Result != tt.want || got.ErrorCode != tt.code {
+				t.Errorf("HandleRequest() = '%v' (%v), want '%v' (%v)", got.Result, got.ErrorCode, tt.want, tt.code)
+			}
+		})
+	}
+
+	// runtime rules override the configured ones
+	run := func(user, args string) string {
+		got, _ := HandleRequest(context.Background(), &Command{User: user, Source: "#random", Command: "policy", Arguments: args})
+		return got.Result
+	}
+
+	if got := run("nick", "allow here paid"); got != "Only admins can change policies" {
+		t.Errorf("Policy() by a normal user = '%v'", got)
+	}
+	if got := run("admin", "allow here paid"); got != "Policy updated: allow #random paid" {
+		t.Errorf("Policy() by an admin = '%v'", got)
+	}
+
+	got, _ := HandleRequest(context.Background(), &Command{Source: "#random", Command: "paid"})
+	if got.Result != "expensive" {
+		t.Errorf("HandleRequest() after allow = '%v', want 'expensive'", got.Result)
+	}
+
+	if got := run("nick", "list #random"); !strings.Contains(got, "allow #random paid") {
+		t.Errorf("Policy() list = '%v', want it to contain the runtime rule", got)
+	}
+}
+
+func TestPolicyCannotBeDisabled(t *testing.T) {
+	SetPolicyStore(policy.NewMemoryStore())
+	defer SetPolicyStore(nil)
+	t.Setenv("POLICY_RULES", `[{"source": "*", "command": "*", "allow": false}]`)
+
+	got, _ := HandleRequest(context.Background(), &Command{Source: "#locked", Command: "policy"})
+	if got.ErrorCode != "" {
+		t.Errorf("HandleRequest() policy error code = '%v', want none", got.ErrorCode)
+	}
+
+	help, _ := HandleRequest(context.Background(), &Command{Source: "#locked", Command: "help"})
+	if help.ErrorCode != ErrorDisabled {
+		t.Errorf("HandleRequest() help error code = '%v', want '%v'", help.ErrorCode, ErrorDisabled)
+	}
+}
+
+func TestPolicyRulesInvalid(t *testing.T) {
+	store := policy.NewMemoryStore()
+	SetPolicyStore(store)
+	defer SetPolicyStore(nil)
+	t.Setenv("POLICY_RULES", `[{"source": "*", "command": "paid", "allow": false`)
+
+	RegisterHandler("paid", func(args string) (string, error) {
+		return "expensive", nil
+	})
+	defer delete(handlers, "paid")
+
+	// broken configuration denies every command instead of allowing all of them
+	got, _ := HandleRequest(context.Background(), &Command{Source: "#random", Command: "paid"})
+	if got.ErrorCode != ErrorDisabled {
+		t.Errorf("HandleRequest() error code = '%v', want '%v'", got.ErrorCode, ErrorDisabled)
+	}
+
+	// rules edited at runtime still apply
+	_ = store.Update(context.Background(), func(rules []policy.Rule) []policy.Rule {
+		return policy.Set(rules, policy.Rule{Source: "#paid", Command: "paid", Allow: true})
+	})
+	got, _ = HandleRequest(context.Background(), &Command{Source: "#paid", Command: "paid"})
+	if got.Result != "expensive" {
+		t.Errorf("HandleRequest() with a runtime allow = '%v' (%v), want 'expensive'", got.Result, got.ErrorCode)
+	}
+
+	list, _ := HandleRequest(context.Background(), &Command{Source: "#random", Command: "policy", Arguments: "list"})
+	if !strings.Contains(list.Result, "deny * *") {
+		t.Errorf("Policy() list = '%v', want it to show the deny * * in effect", list.Result)
+	}
+}
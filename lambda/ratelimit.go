@@ -0,0 +1,102 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/ratelimit"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorRateLimited is set as the error code of throttled commands
+const ErrorRateLimited = "rate_limited"
+
+var (
+	limiterMu sync.Mutex
+	limiter   ratelimit.Store
+)
+
+// SetRateLimiter replaces the store used for rate limits
+func SetRateLimiter(store ratelimit.Store) {
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+	limiter = store
+}
+
+// rateLimiter returns the configured store, defaulting to Redis when available and memory otherwise
+func rateLimiter() ratelimit.Store {
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+
+	if limiter == nil {
+		if client := RedisClient(); client != nil {
+			limiter = ratelimit.NewRedisStore(client)
+		} else {
+			limiter = ratelimit.NewMemoryStore()
+		}
+	}
+	return limiter
+}
+
+// limitsFor returns the user and source limits of a handler.
+// RATELIMIT_<COMMAND>_USER and RATELIMIT_<COMMAND>_SOURCE override the registered limits, e.g. RATELIMIT_WA_USER=5/1m
+func limitsFor(h *Handler) (user, source ratelimit.Limit) {
+	user, source = h.UserLimit, h.SourceLimit
+
+	prefix := "RATELIMIT_" + strings.ToUpper(h.Name)
+	if l, ok := limitFromEnv(prefix + "_USER"); ok {
+		user = l
+	}
+	if l, ok := limitFromEnv(prefix + "_SOURCE"); ok {
+		source = l
+	}
+	return user, source
+}
+
+func limitFromEnv(key string) (ratelimit.Limit, bool) {
+	value := config.Get(key)
+	if value == "" {
+		return ratelimit.Limit{}, false
+	}
+
+	l, err := ratelimit.ParseLimit(value)
+	if err != nil {
+		log.Warnf("Ignoring %s: %v", key, err)
+		return ratelimit.Limit{}, false
+	}
+	return l, true
+}
+
+// checkRateLimit returns a "slow down" reply if the user or the source has run out of tokens for the command.
+// Errors from the store are logged and the command is allowed, a broken Redis shouldn't take the bot down.
+func checkRateLimit(ctx context.Context, h *Handler, cmd *Command) (string, bool) {
+	userLimit, sourceLimit := limitsFor(h)
+	if userLimit.Unlimited() && sourceLimit.Unlimited() {
+		return "", true
+	}
+
+	buckets := []ratelimit.Bucket{
+		{Key: fmt.Sprintf("%s:user:%s", h.Name, cmd.User), Limit: userLimit},
+		{Key: fmt.Sprintf("%s:source:%s", h.Name, cmd.Source), Limit: sourceLimit},
+	}
+	who := []string{"you", "this channel"}
+
+	// both buckets are checked before a token is taken from either,
+	// so a request denied for the channel doesn't use up the user's quota
+	denied, retryAfter, err := rateLimiter().AllowAll(ctx, buckets)
+	if err != nil {
+		log.WithContext(ctx).Warnf("Rate limit check failed for %s: %v", h.Name, err)
+		return "", true
+	}
+	if denied >= 0 {
+		log.WithContext(ctx).WithField("bucket", buckets[denied].Key).Infof("Rate limited %v", cmd)
+		return fmt.Sprintf("Slow down, %s can use %s again in %s", who[denied], h.Name, retryAfter.Round(time.Second).String()), false
+	}
+
+	return "", true
+}
@@ -0,0 +1,116 @@
+package lambda
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/cache"
+	"github.com/lepinkainen/lambdabot/ratelimit"
+)
+
+func TestHandleRequestRateLimit(t *testing.T) {
+	SetRateLimiter(ratelimit.NewMemoryStore())
+	defer SetRateLimiter(nil)
+
+	Register(Handler{
+		Name:        "testlimited",
+		UserLimit:   ratelimit.Limit{Burst: 2, Period: time.Hour},
+		SourceLimit: ratelimit.Limit{Burst: 3, Period: time.Hour},
+		Func:        func(context.Context, *Command) (string, error) { return "ok", nil },
+	})
+	defer delete(handlers, "testlimited")
+
+	run := func(user, source string) *Command {
+		t.Helper()
+		got, err := HandleRequest(context.Background(), &Command{User: user, Source: source, Command: "testlimited"})
+		if err != nil {
+			t.Fatalf("HandleRequest() error = %v", err)
+		}
+		return got
+	}
+
+	for range 2 {
+		if got := run("alice", "#chan"); got.Result != "ok" {
+			t.Fatalf("Result = '%v', want 'ok'", got.Result)
+		}
+	}
+
+	got := run("alice", "#chan")
+	if got.ErrorCode != ErrorRateLimited || !strings.HasPrefix(got.Result, "Slow down, you can use testlimited again in") {
+		t.Errorf("Result = '%v', ErrorCode = '%v', want user throttled", got.Result, got.ErrorCode)
+	}
+
+	// third run in the channel uses the last source token
+	if got := run("bob", "#chan"); got.Result != "ok" {
+		t.Errorf("Result = '%v', want 'ok' for another user", got.Result)
+	}
+
+	got = run("carol", "#chan")
+	if got.ErrorCode != ErrorRateLimited || !strings.HasPrefix(got.Result, "Slow down, this channel") {
+		t.Errorf("Result = '%v', ErrorCode = '%v', want source throttled", got.Result, got.ErrorCode)
+	}
+}
+
+func TestLimitsForEnvOverride(t *testing.T) {
+	h := &Handler{Name: "testenv", UserLimit: ratelimit.Limit{Burst: 1, Period: time.Minute}}
+
+	t.Setenv("RATELIMIT_TESTENV_USER", "10/1h")
+	t.Setenv("RATELIMIT_TESTENV_SOURCE", "garbage")
+
+	user, source := limitsFor(h)
+	if user != (ratelimit.Limit{Burst: 10, Period: time.Hour}) {
+		t.Errorf("user limit = %v, want 10/1h", user)
+	}
+	if !source.Unlimited() {
+		t.Errorf("source limit = %v, want unlimited for an invalid override", source)
+	}
+}
+
+func TestRateLimitConsumesNothingWhenDenied(t *testing.T) {
+	SetRateLimiter(ratelimit.NewMemoryStore())
+	defer SetRateLimiter(nil)
+	SetCache(cache.NewMemoryStore())
+	defer SetCache(nil)
+
+	calls := 0
+	Register(Handler{
+		Name:        "testquota",
+		UserLimit:   ratelimit.Limit{Burst: 2, Period: time.Hour},
+		SourceLimit: ratelimit.Limit{Burst: 1, Period: time.Hour},
+		CacheTTL:    FixedTTL(time.Hour),
+		Func: func(context.Context, *Command) (string, error) {
+			calls++
+			return "ok", nil
+		},
+	})
+	defer delete(handlers, "testquota")
+
+	run := func(source, args string) *Command {
+		t.Helper()
+		got, err := HandleRequest(context.Background(), &Command{User: "alice", Source: source, Command: "testquota", Arguments: args})
+		if err != nil {
+			t.Fatalf("HandleRequest() error = %v", err)
+		}
+		return got
+	}
+
+	// the only source token goes to the first run, cached answers don't need one
+	for range 3 {
+		if got := run("#chan", "same"); got.Result != "ok" {
+			t.Fatalf("Result = '%v' (%v), want 'ok' from the cache", got.Result, got.ErrorCode)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+
+	// the channel is out of tokens, which must not cost alice one of hers
+	if got := run("#chan", "other"); got.ErrorCode != ErrorRateLimited {
+		t.Errorf("ErrorCode = '%v', want the source throttled", got.ErrorCode)
+	}
+	if got := run("#elsewhere", "other"); got.Result != "ok" {
+		t.Errorf("Result = '%v' (%v), want alice's second token still there", got.Result, got.ErrorCode)
+	}
+}
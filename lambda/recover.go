@@ -0,0 +1,162 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/report"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorPanic is set as the error code of commands whose handler panicked
+const ErrorPanic = "handler_panic"
+
+// reportTimeout limits how long sending an incident can delay the reply
+const reportTimeout = 2 * time.Second
+
+var (
+	reporterOnce sync.Once
+	reporterMu   sync.Mutex
+	reporter     *report.Client
+)
+
+func init() {
+	config.Register(config.Setting{
+		Key:         "ERROR_REPORT_DSN",
+		Description: "Sentry compatible DSN that handler panics are reported to, e.g. https://key@sentry.example.com/1",
+		Secret:      true,
+		Validate: func(value string) error {
+			_, err := report.New(value, "")
+			return err
+		},
+	})
+}
+
+// SetErrorReporter replaces the client panics are reported with, nil disables reporting
+func SetErrorReporter(client *report.Client) {
+	reporterOnce.Do(func() {})
+	reporterMu.Lock()
+	defer reporterMu.Unlock()
+	reporter = client
+}
+
+// errorReporter returns the client for ERROR_REPORT_DSN, or nil if it isn't set
+func errorReporter() *report.Client {
+	reporterOnce.Do(func() {
+		dsn := config.Get("ERROR_REPORT_DSN")
+		if dsn == "" {
+			return
+		}
+		client, err := report.New(dsn, "")
+		if err != nil {
+			log.Warnf("Error reporting disabled: %v", err)
+			return
+		}
+		reporter = client
+	})
+
+	reporterMu.Lock()
+	defer reporterMu.Unlock()
+	return reporter
+}
+
+// runHandler runs the handler function in a span named after the command.
+// A panicking handler is logged with its stack, reported and answered with a friendly error.
+func runHandler(ctx context.Context, h *Handler, cmd *Command) (res string, err error) {
+	ctx, span := StartSpan(ctx, "handler "+h.Name, trace.SpanKindInternal)
+	defer span.End()
+
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+
+		message := fmt.Sprint(value)
+		log.WithContext(ctx).WithField("stack", string(debug.Stack())).Errorf("Command %s panicked: %s", h.Name, message)
+		span.SetStatus(codes.Error, "panic: "+message)
+		reportPanic(ctx, h, cmd, message, report.Callers(1))
+
+		cmd.ErrorCode = ErrorPanic
+		res, err = fmt.Sprintf("Sorry, %s failed unexpectedly", h.Name), nil
+	}()
+
+	res, err = h.Func(context.WithValue(ctx, runningKey{}, running{h, cmd}), cmd)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return res, err
+}
+
+// running is the handler and command a context belongs to, so goroutines of the handler can report panics
+type running struct {
+	handler *Handler
+	cmd     *Command
+}
+
+type runningKey struct{}
+
+// Go runs fn in a goroutine of the wait group. A panic in it is logged and reported like one in the handler
+// instead of crashing the whole process, the handler carries on without what fn would have done.
+// Handlers use it for their fan-outs, ctx is the one the handler got.
+func Go(ctx context.Context, wg *sync.WaitGroup, fn func()) {
+	wg.Go(func() {
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+
+			message := fmt.Sprint(value)
+			r, ok := ctx.Value(runningKey{}).(running)
+			if !ok {
+				log.WithContext(ctx).WithField("stack", string(debug.Stack())).Errorf("Goroutine panicked: %s", message)
+				return
+			}
+			log.WithContext(ctx).WithField("stack", string(debug.Stack())).Errorf("Goroutine of %s panicked: %s", r.handler.Name, message)
+			trace.SpanFromContext(ctx).SetStatus(codes.Error, "panic: "+message)
+			reportPanic(ctx, r.handler, r.cmd, message, report.Callers(1))
+		}()
+
+		fn()
+	})
+}
+
+// reportPanic sends the panic to the error tracker, failures are only logged
+func reportPanic(ctx context.Context, h *Handler, cmd *Command, message string, frames []report.Frame) {
+	client := errorReporter()
+	if client == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), reportTimeout)
+	defer cancel()
+
+	tags := map[string]string{"command": h.Name, "source": cmd.Source}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		tags["trace_id"] = span.TraceID().String()
+	}
+
+	id, err := client.Capture(ctx, report.Event{
+		Type:   "panic",
+		Value:  message,
+		Frames: frames,
+		Tags:   tags,
+		// the user is left out, nicks don't belong in an external tracker
+		Extra: map[string]any{"args": cmd.Arguments},
+	})
+	if err != nil {
+		log.WithContext(ctx).Warnf("Unable to report panic of %s: %v", h.Name, err)
+		return
+	}
+	log.WithContext(ctx).WithField("event_id", id).Infof("Reported panic of %s", h.Name)
+}
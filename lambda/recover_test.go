@@ -0,0 +1,102 @@
+package lambda
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lepinkainen/lambdabot/report"
+)
+
+// collectReports sends incidents to a test server for the rest of the test, returns the bodies it got
+func collectReports(t *testing.T) *[]string {
+	t.Helper()
+
+	var (
+		mu       sync.Mutex
+		reported []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		reported = append(reported, string(body))
+		mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := report.New(strings.Replace(server.URL, "://", "://key@", 1)+"/1", "")
+	if err != nil {
+		t.Fatalf("report.New() error = %v", err)
+	}
+	SetErrorReporter(client)
+	t.Cleanup(func() { SetErrorReporter(nil) })
+	return &reported
+}
+
+func TestHandleRequestRecoversPanics(t *testing.T) {
+	reported := collectReports(t)
+
+	RegisterContextHandler("crash", func(_ context.Context, cmd *Command) (string, error) {
+		var episodes []string
+		return episodes[len(episodes)-1], nil
+	})
+	defer delete(handlers, "crash")
+
+	tests := []struct {
+		command string
+		want    string
+		report  string
+	}{
+		{"crash", "Sorry, crash failed unexpectedly", "index out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			*reported = nil
+			got, err := HandleRequest(context.Background(), &Command{Source: "#channel", User: "nick", Command: tt.command})
+			if err != nil {
+				t.Fatalf("HandleRequest() error = %v", err)
+			}
+			if got.Result != tt.want || got.ErrorCode != ErrorPanic {
+				t.Errorf("HandleRequest() = '%v' (%v), want '%v' (%v)", got.Result, got.ErrorCode, tt.want, ErrorPanic)
+			}
+			if len(*reported) != 1 || !strings.Contains((*reported)[0], tt.report) || !strings.Contains((*reported)[0], `"command":"`+tt.command+`"`) {
+				t.Errorf("reported %q, want one event with '%v'", *reported, tt.report)
+			}
+			if len(*reported) == 1 && strings.Contains((*reported)[0], "nick") {
+				t.Errorf("reported %q, want the user left out", *reported)
+			}
+		})
+	}
+}
+
+func TestGoRecoversPanics(t *testing.T) {
+	reported := collectReports(t)
+
+	RegisterContextHandler("fanout", func(ctx context.Context, cmd *Command) (string, error) {
+		results := make([]string, 2)
+		var wg sync.WaitGroup
+		Go(ctx, &wg, func() { results[0] = "one" })
+		Go(ctx, &wg, func() {
+			var parts []string
+			results[1] = parts[1]
+		})
+		wg.Wait()
+		return strings.Join(results, ","), nil
+	})
+	defer delete(handlers, "fanout")
+
+	got, err := HandleRequest(context.Background(), &Command{Source: "#channel", Command: "fanout"})
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if got.Result != "one," || got.ErrorCode != "" {
+		t.Errorf("HandleRequest() = '%v' (%v), want '%v'", got.Result, got.ErrorCode, "one,")
+	}
+	if len(*reported) != 1 || !strings.Contains((*reported)[0], "index out of range") || !strings.Contains((*reported)[0], `"command":"fanout"`) {
+		t.Errorf("reported %q, want one event of the fanout goroutine", *reported)
+	}
+}
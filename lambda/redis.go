@@ -0,0 +1,98 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/metrics"
+)
+
+var (
+	redisOnce   sync.Once
+	redisClient *redis.Client
+)
+
+// RedisClient returns the shared Redis client, or nil if REDIS_ADDR isn't set.
+// The client is created on first use and reused across warm Lambda invocations.
+func RedisClient() *redis.Client {
+	redisOnce.Do(func() {
+		addr := config.Get("REDIS_ADDR")
+		if addr == "" {
+			return
+		}
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Username: "default",
+			Password: config.Get("REDIS_PASSWORD"),
+			DB:       0, // use default DB
+		})
+		redisClient.AddHook(upstreamHook{})
+	})
+	return redisClient
+}
+
+// upstreamHook records the time spent in Redis as upstream latency of the command and traces every call
+type upstreamHook struct{}
+
+func (upstreamHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (upstreamHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := StartSpan(ctx, "redis "+cmd.Name(), trace.SpanKindClient,
+			attribute.String("db.system", "redis"),
+			attribute.String("db.statement", redisStatement(cmd)))
+
+		start := time.Now()
+		err := next(ctx, cmd)
+		metrics.RecordUpstream(ctx, "redis", time.Since(start))
+		EndSpan(span, redisError(err))
+		return err
+	}
+}
+
+func (upstreamHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		ctx, span := StartSpan(ctx, "redis pipeline", trace.SpanKindClient,
+			attribute.String("db.system", "redis"),
+			attribute.Int("db.operation.batch.size", len(cmds)))
+
+		start := time.Now()
+		err := next(ctx, cmds)
+		metrics.RecordUpstream(ctx, "redis", time.Since(start))
+		EndSpan(span, redisError(err))
+		return err
+	}
+}
+
+// redisError leaves out redis.Nil, a missing key isn't a failed call
+func redisError(err error) error {
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	return err
+}
+
+// redisStatement is the command with its arguments, leaving out those of commands that carry credentials
+func redisStatement(cmd redis.Cmder) string {
+	switch cmd.Name() {
+	case "auth", "hello":
+		return cmd.Name()
+	}
+
+	args := make([]string, len(cmd.Args()))
+	for i, arg := range cmd.Args() {
+		args[i] = fmt.Sprint(arg)
+	}
+	return strings.Join(args, " ")
+}
@@ -0,0 +1,131 @@
+package lambda
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/ratelimit"
+	"github.com/lepinkainen/lambdabot/role"
+)
+
+// Handler describes a command, its help texts and the function that runs it
+type Handler struct {
+	// Name is the primary command name, e.g. "ep"
+	Name string
+	// Aliases are alternative names that run the same handler
+	Aliases []string
+	// Summary is a one-line description shown in the command listing
+	Summary string
+	// Usage shows the arguments the command takes, e.g. "ep <show name>"
+	Usage string
+	// Examples are full example invocations
+	Examples []string
+	// Category groups commands in the help listing
+	Category string
+	// UserLimit limits how often a single user can run the command, zero is unlimited
+	UserLimit ratelimit.Limit
+	// SourceLimit limits how often the command can be run in a single source, zero is unlimited
+	SourceLimit ratelimit.Limit
+	// CacheTTL enables caching of successful results by command and arguments, nil disables caching
+	CacheTTL CacheTTL
+	// CacheVary is added to the cache key of results that depend on who runs the command, nil shares them
+	CacheVary func(cmd *Command) string
+	// Requires lists the config keys the command needs, "A|B" needs either one.
+	// Commands with missing keys answer "not configured".
+	Requires []string
+	// MinRole is the least trusted role that can run the command, the zero value allows normal users
+	MinRole role.Role
+	// Func runs the command
+	Func HandlerFunc
+}
+
+// DefaultCategory is used for handlers registered without a category
+const DefaultCategory = "misc"
+
+var (
+	// handlers maps command names and aliases to their handler
+	handlers = make(map[string]*Handler)
+)
+
+// Register adds a handler with its metadata, the handler is reachable by its name and all of its aliases
+func Register(handler Handler) {
+	if handler.Name == "" {
+		panic("lambda: handler registered without a name")
+	}
+	if handler.Func == nil {
+		panic(fmt.Sprintf("lambda: handler %s registered without a function", handler.Name))
+	}
+	if handler.Category == "" {
+		handler.Category = DefaultCategory
+	}
+
+	// document the overrides of rate limited commands
+	if !handler.UserLimit.Unlimited() || !handler.SourceLimit.Unlimited() {
+		prefix := "RATELIMIT_" + strings.ToUpper(handler.Name)
+		config.Register(config.Setting{
+			Key:         prefix + "_USER",
+			Description: fmt.Sprintf("Per user rate limit of %s, default %s", handler.Name, handler.UserLimit),
+			Validate:    validLimit,
+		})
+		config.Register(config.Setting{
+			Key:         prefix + "_SOURCE",
+			Description: fmt.Sprintf("Per source rate limit of %s, default %s", handler.Name, handler.SourceLimit),
+			Validate:    validLimit,
+		})
+	}
+
+	h := &handler
+	handlers[h.Name] = h
+	for _, alias := range h.Aliases {
+		handlers[alias] = h
+	}
+}
+
+// MissingConfig returns the required config keys that aren't set
+func (h *Handler) MissingConfig() []string {
+	return config.Missing(h.Requires...)
+}
+
+func validLimit(value string) error {
+	_, err := ratelimit.ParseLimit(value)
+	return err
+}
+
+// Lookup returns the handler registered for the given command name or alias, case-insensitively
+func Lookup(command string) (*Handler, bool) {
+	h, ok := handlers[strings.ToLower(command)]
+	return h, ok
+}
+
+// Handlers returns all registered handlers once each, sorted by category and name
+func Handlers() []*Handler {
+	var list []*Handler
+	for name, h := range handlers {
+		// skip alias entries
+		if name != h.Name {
+			continue
+		}
+		list = append(list, h)
+	}
+
+	slices.SortFunc(list, func(a, b *Handler) int {
+		if c := strings.Compare(a.Category, b.Category); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return list
+}
+
+// Names returns all command names and aliases that can be used to run a command
+func Names() []string {
+	names := make([]string, 0, len(handlers))
+	for name := range handlers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,120 @@
+package lambda
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/render"
+)
+
+func init() {
+	config.Register(config.Setting{
+		Key:         "SOURCE_LIMITS",
+		Description: "Comma separated source=bytes[/messages] message limits, * for all sources, e.g. *=400/3",
+		Validate:    validSourceLimits,
+	})
+	config.Register(config.Setting{Key: "SOURCE_FORMATS", Description: "Comma separated source=format pairs, e.g. #channel=irc, formats are plain, irc, slack, discord, telegram and matrix"})
+}
+
+// formatFor picks the output format of the command: the format field of the request,
+// then SOURCE_FORMATS, then a platform prefix of the source like "slack:#general", and plain for everything else
+func formatFor(cmd *Command) render.Format {
+	if f, ok := render.ParseFormat(cmd.Format); ok {
+		return f
+	}
+
+	for _, pair := range config.List("SOURCE_FORMATS") {
+		source, name, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(source) != cmd.Source {
+			continue
+		}
+		if f, ok := render.ParseFormat(name); ok {
+			return f
+		}
+	}
+
+	if platform, _, ok := strings.Cut(cmd.Source, ":"); ok {
+		if f, ok := render.ParseFormat(platform); ok {
+			return f
+		}
+	}
+
+	return render.Plain
+}
+
+// limitFor picks the message limit of the command: the source in SOURCE_LIMITS, then its * entry,
+// then the default of the format
+func limitFor(cmd *Command, format render.Format) render.Limit {
+	var fallback *render.Limit
+	for _, pair := range config.List("SOURCE_LIMITS") {
+		source, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		source = strings.TrimSpace(source)
+		if source != cmd.Source && source != "*" {
+			continue
+		}
+
+		l, err := render.ParseLimit(value)
+		if err != nil {
+			continue
+		}
+		if source == cmd.Source {
+			return l
+		}
+		fallback = &l
+	}
+
+	if fallback != nil {
+		return *fallback
+	}
+	return render.DefaultLimit(format)
+}
+
+// validSourceLimits checks every source=limit pair of SOURCE_LIMITS
+func validSourceLimits(value string) error {
+	for pair := range strings.SplitSeq(value, ",") {
+		_, limit, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("invalid pair %q, use source=limit", strings.TrimSpace(pair))
+		}
+		if _, err := render.ParseLimit(limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderResult formats the result lines into Result for the platform of the command
+// and splits it into Messages if it's over the limit of the source.
+// Plain results are left as the handler wrote them.
+func renderResult(cmd *Command) {
+	format := formatFor(cmd)
+	cmd.Format = string(format)
+	if len(cmd.Lines) == 0 {
+		return
+	}
+
+	lines := []render.Line{{Text: cmd.Result}}
+	if format != render.Plain {
+		lines = make([]render.Line, len(cmd.Lines))
+		for i, l := range cmd.Lines {
+			lines[i] = render.Line{Text: l.Text, Title: l.Title, URL: l.URL, Severity: string(l.Severity)}
+		}
+		cmd.Result = render.Render(format, lines)
+	}
+
+	limit := limitFor(cmd, format)
+	if limit == (render.Limit{}) {
+		return
+	}
+
+	// old clients only read Result, the first message is all they can send without going over the limit
+	messages := render.Split(format, lines, limit)
+	if len(messages) > 1 || (len(messages) == 1 && messages[0] != cmd.Result) {
+		cmd.Messages = messages
+		cmd.Result = messages[0]
+	}
+}
@@ -0,0 +1,124 @@
+package lambda
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/cache"
+	"github.com/lepinkainen/lambdabot/render"
+)
+
+func TestFormatFor(t *testing.T) {
+	t.Setenv("SOURCE_FORMATS", "#bridged=discord, #broken=nope")
+
+	tests := []struct {
+		name string
+		cmd  Command
+		want render.Format
+	}{
+		{"explicit format", Command{Source: "slack:#general", Format: "telegram"}, render.Telegram},
+		{"source prefix", Command{Source: "slack:#general"}, render.Slack},
+		{"configured source", Command{Source: "#bridged"}, render.Discord},
+		{"invalid explicit format", Command{Source: "matrix:!room:example.org", Format: "nope"}, render.Matrix},
+		{"invalid configured format", Command{Source: "#broken"}, render.Plain},
+		{"irc channel", Command{Source: "#channel"}, render.Plain},
+		{"no source", Command{}, render.Plain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatFor(&tt.cmd); got != tt.want {
+				t.Errorf("formatFor() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleRequestRenders(t *testing.T) {
+	SetCache(cache.NewMemoryStore())
+	defer SetCache(nil)
+
+	Register(Handler{
+		Name:     "linked",
+		CacheTTL: FixedTTL(time.Minute),
+		Func: func(_ context.Context, cmd *Command) (string, error) {
+			cmd.AddLine(ResultLine{Text: "Show <1x01>", Title: "Show", URL: "https://example.com/1"})
+			cmd.AddLine(ResultLine{Text: "Cancelled", Severity: SeverityWarning})
+			return "", nil
+		},
+	})
+	defer delete(handlers, "linked")
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"#channel", "Show <1x01> | Cancelled"},
+		// cached results are rendered again for each platform
+		{"slack:#general", "Show &lt;1x01&gt; <https://example.com/1|Show>\n:warning: *Cancelled*"},
+		{"telegram:42", "Show &lt;1x01&gt; <a href=\"https://example.com/1\">Show</a>\n⚠️ <b>Cancelled</b>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			got, err := HandleRequest(context.Background(), &Command{Source: tt.source, Command: "linked"})
+			if err != nil {
+				t.Fatalf("HandleRequest() error = %v", err)
+			}
+			if got.Result != tt.want {
+				t.Errorf("HandleRequest() = '%v', want '%v'", got.Result, tt.want)
+			}
+			if got.Lines[0].Text != "Show <1x01>" {
+				t.Errorf("HandleRequest() line = '%v', want the neutral text", got.Lines[0].Text)
+			}
+		})
+	}
+}
+
+func TestLimitFor(t *testing.T) {
+	t.Setenv("SOURCE_LIMITS", "*=300/3, #small=100, #broken=x")
+
+	tests := []struct {
+		source string
+		format render.Format
+		want   render.Limit
+	}{
+		{"#small", render.Plain, render.Limit{MaxBytes: 100}},
+		{"#other", render.Plain, render.Limit{MaxBytes: 300, MaxMessages: 3}},
+		{"#broken", render.Plain, render.Limit{MaxBytes: 300, MaxMessages: 3}},
+	}
+	for _, tt := range tests {
+		if got := limitFor(&Command{Source: tt.source}, tt.format); got != tt.want {
+			t.Errorf("limitFor(%s) = %v, want %v", tt.source, got, tt.want)
+		}
+	}
+
+	t.Setenv("SOURCE_LIMITS", "")
+	if got := limitFor(&Command{Source: "irc:#channel"}, render.IRC); got != render.DefaultLimit(render.IRC) {
+		t.Errorf("limitFor() without SOURCE_LIMITS = %v, want the IRC default", got)
+	}
+}
+
+func TestHandleRequestSplitsMessages(t *testing.T) {
+	t.Setenv("SOURCE_LIMITS", "#irc=24/2")
+
+	RegisterHandler("long", func(args string) (string, error) {
+		return "Helsinki: sunny, 20°C ⚠️ Wind warning ⚠️ Flood warning ⚠️ Frost warning", nil
+	})
+	defer delete(handlers, "long")
+
+	got, _ := HandleRequest(context.Background(), &Command{Source: "#irc", Command: "long"})
+	want := []string{"Helsinki: sunny, 20°C", "⚠️ Wind warning…"}
+	if len(got.Messages) != 2 || got.Messages[0] != want[0] || got.Messages[1] != want[1] {
+		t.Errorf("HandleRequest() messages = %q, want %q", got.Messages, want)
+	}
+	if got.Result != want[0] {
+		t.Errorf("HandleRequest() = '%v', want the first message", got.Result)
+	}
+
+	// no limit, no messages
+	got, _ = HandleRequest(context.Background(), &Command{Source: "#other", Command: "long"})
+	if got.Messages != nil || !strings.HasSuffix(got.Result, "Frost warning") {
+		t.Errorf("HandleRequest() without limit = '%v' %q", got.Result, got.Messages)
+	}
+}
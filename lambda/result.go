@@ -0,0 +1,59 @@
+package lambda
+
+import "strings"
+
+// Severity tells clients how important a result line is
+type Severity string
+
+// Severities for result lines, an empty severity is treated as info
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// Machine-readable error codes set in Command.ErrorCode
+const (
+	ErrorUnknownCommand = "unknown_command"
+	ErrorHandler        = "handler_error"
+	ErrorNotConfigured  = "not_configured"
+)
+
+// resultSeparator joins result lines into the single line Result for old clients
+const resultSeparator = " | "
+
+// ResultLine is a single line of a structured result with optional metadata
+type ResultLine struct {
+	Text     string   `json:"text"`
+	Title    string   `json:"title,omitempty"`
+	URL      string   `json:"url,omitempty"`
+	Severity Severity `json:"severity,omitempty"`
+}
+
+// AddLine appends a line to the structured result of the command
+func (cmd *Command) AddLine(line ResultLine) {
+	cmd.Lines = append(cmd.Lines, line)
+}
+
+// AddText appends a plain text line to the structured result of the command
+func (cmd *Command) AddText(text string) {
+	cmd.AddLine(ResultLine{Text: text})
+}
+
+// setResult fills both Result and Lines from what the handler returned.
+//
+// Handlers can return a plain string, add lines with AddLine, or do both.
+// A plain string becomes the only line, lines without a string are joined into Result.
+func (cmd *Command) setResult(res string) {
+	switch {
+	case len(cmd.Lines) == 0 && res != "":
+		cmd.Lines = []ResultLine{{Text: res}}
+	case len(cmd.Lines) > 0 && res == "":
+		texts := make([]string, 0, len(cmd.Lines))
+		for _, line := range cmd.Lines {
+			texts = append(texts, line.Text)
+		}
+		res = strings.Join(texts, resultSeparator)
+	}
+	cmd.Result = res
+}
@@ -0,0 +1,49 @@
+package lambda
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHandleRequestLines(t *testing.T) {
+	Register(Handler{Name: "testlines", Func: func(_ context.Context, cmd *Command) (string, error) {
+		cmd.AddLine(ResultLine{Text: "first", URL: "https://example.com"})
+		cmd.AddLine(ResultLine{Text: "second", Severity: SeverityWarning})
+		return "", nil
+	}})
+	Register(Handler{Name: "teststring", Func: func(context.Context, *Command) (string, error) {
+		return "plain", nil
+	}})
+	Register(Handler{Name: "testerror", Func: func(context.Context, *Command) (string, error) {
+		return "", errors.New("upstream down")
+	}})
+	defer func() {
+		delete(handlers, "testlines")
+		delete(handlers, "teststring")
+		delete(handlers, "testerror")
+	}()
+
+	got, _ := HandleRequest(context.Background(), &Command{Command: "testlines"})
+	if got.Result != "first | second" {
+		t.Errorf("Result = '%v', want 'first | second'", got.Result)
+	}
+	if len(got.Lines) != 2 || got.Lines[0].URL != "https://example.com" || got.Lines[1].Severity != SeverityWarning {
+		t.Errorf("Lines = %+v", got.Lines)
+	}
+
+	got, _ = HandleRequest(context.Background(), &Command{Command: "teststring"})
+	if got.Result != "plain" || len(got.Lines) != 1 || got.Lines[0].Text != "plain" {
+		t.Errorf("Result = '%v', Lines = %+v, want a single 'plain' line", got.Result, got.Lines)
+	}
+
+	got, err := HandleRequest(context.Background(), &Command{Command: "testerror"})
+	if err == nil || got.ErrorCode != ErrorHandler {
+		t.Errorf("ErrorCode = '%v', err = %v, want %v", got.ErrorCode, err, ErrorHandler)
+	}
+
+	got, _ = HandleRequest(context.Background(), &Command{Command: "nosuchcommand"})
+	if got.ErrorCode != ErrorUnknownCommand || len(got.Lines) != 0 {
+		t.Errorf("ErrorCode = '%v', Lines = %+v, want %v without lines", got.ErrorCode, got.Lines, ErrorUnknownCommand)
+	}
+}
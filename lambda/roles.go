@@ -0,0 +1,209 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/role"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Error codes for commands the user isn't allowed to run
+const (
+	ErrorBanned    = "banned"
+	ErrorForbidden = "forbidden"
+)
+
+var (
+	roleMu    sync.Mutex
+	roleStore role.Store
+)
+
+// SetRoleStore replaces the store used for user roles
+func SetRoleStore(store role.Store) {
+	roleMu.Lock()
+	defer roleMu.Unlock()
+	roleStore = store
+}
+
+// roles returns the configured store, defaulting to Redis when available and memory otherwise
+func roles() role.Store {
+	roleMu.Lock()
+	defer roleMu.Unlock()
+
+	if roleStore == nil {
+		if client := RedisClient(); client != nil {
+			roleStore = role.NewRedisStore(client)
+		} else {
+			roleStore = role.NewMemoryStore()
+		}
+	}
+	return roleStore
+}
+
+// bootstrapAdmin checks ADMIN_USERS, they're admins everywhere whatever the store says.
+// Entries are source:user, the same nick in another source can be anyone.
+func bootstrapAdmin(cmd *Command) bool {
+	return cmd.User != "" && slices.Contains(config.List("ADMIN_USERS"), cmd.Source+":"+cmd.User)
+}
+
+// validAdminUsers requires a source for every user in ADMIN_USERS
+func validAdminUsers(value string) error {
+	for entry := range strings.SplitSeq(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if i := strings.LastIndex(entry, ":"); i <= 0 || i == len(entry)-1 {
+			return fmt.Errorf("invalid admin %q, use source:user", entry)
+		}
+	}
+	return nil
+}
+
+// userRole returns the role of the command's user in its source.
+// Store errors are logged and the user is treated as a normal user.
+func userRole(ctx context.Context, cmd *Command) role.Role {
+	if bootstrapAdmin(cmd) {
+		return role.Admin
+	}
+	if cmd.User == "" {
+		return role.Normal
+	}
+
+	r, err := role.Resolve(ctx, roles(), cmd.Source, cmd.User)
+	if err != nil {
+		log.WithContext(ctx).Warnf("Unable to resolve role of %s: %v", cmd.User, err)
+	}
+	return r
+}
+
+// roleSource maps "here" to the source of the command and defaults to it
+func roleSource(cmd *Command, args []string) string {
+	if len(args) == 0 || args[0] == "here" {
+		return cmd.Source
+	}
+	return args[0]
+}
+
+// canManageRoles reports whether the user of the command may see and change roles in the source.
+// MinRole already made them an admin in the current source, other sources need an admin there,
+// * needs a global admin. Store errors are logged and deny the change.
+func canManageRoles(ctx context.Context, cmd *Command, source string) bool {
+	if source == cmd.Source || bootstrapAdmin(cmd) {
+		return true
+	}
+
+	r, err := role.Resolve(ctx, roles(), source, cmd.User)
+	if err != nil {
+		log.WithContext(ctx).Warnf("Unable to resolve role of %s in %s: %v", cmd.User, source, err)
+		return false
+	}
+	return r >= role.Admin
+}
+
+// Grant assigns a role to a user in a source, the source defaults to the current one and * means every source
+func Grant(ctx context.Context, cmd *Command) (string, error) {
+	args := strings.Fields(cmd.Arguments)
+	if len(args) < 2 {
+		return "Usage: grant <user> <role> [source|here|*]", nil
+	}
+
+	r, err := role.Parse(args[1])
+	if err != nil {
+		return err.Error(), nil
+	}
+	user, source := args[0], roleSource(cmd, args[2:])
+	if !canManageRoles(ctx, cmd, source) {
+		return fmt.Sprintf("Only admins in %s can change roles there", source), nil
+	}
+
+	if err := roles().Set(ctx, source, user, r); err != nil {
+		return "", err
+	}
+
+	log.WithContext(ctx).WithField("user", cmd.User).Infof("Granted %s to %s in %s", r, user, source)
+	return fmt.Sprintf("%s is now %s in %s", user, r, source), nil
+}
+
+// Revoke removes the role of a user in a source, making them a normal user again
+func Revoke(ctx context.Context, cmd *Command) (string, error) {
+	args := strings.Fields(cmd.Arguments)
+	if len(args) < 1 {
+		return "Usage: revoke <user> [source|here|*]", nil
+	}
+	user, source := args[0], roleSource(cmd, args[1:])
+	if !canManageRoles(ctx, cmd, source) {
+		return fmt.Sprintf("Only admins in %s can change roles there", source), nil
+	}
+
+	if err := roles().Delete(ctx, source, user); err != nil {
+		return "", err
+	}
+
+	log.WithContext(ctx).WithField("user", cmd.User).Infof("Revoked role of %s in %s", user, source)
+	return fmt.Sprintf("Revoked role of %s in %s", user, source), nil
+}
+
+// Roles lists the assigned roles in a source, the source defaults to the current one
+func Roles(ctx context.Context, cmd *Command) (string, error) {
+	source := roleSource(cmd, strings.Fields(cmd.Arguments))
+	if !canManageRoles(ctx, cmd, source) {
+		return fmt.Sprintf("Only admins in %s can see roles there", source), nil
+	}
+
+	assigned, err := roles().List(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	if len(assigned) == 0 {
+		return fmt.Sprintf("No roles assigned in %s", source), nil
+	}
+
+	users := make([]string, 0, len(assigned))
+	for user := range assigned {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	texts := make([]string, len(users))
+	for i, user := range users {
+		texts[i] = fmt.Sprintf("%s: %s", user, assigned[user])
+	}
+	return fmt.Sprintf("Roles in %s: %s", source, strings.Join(texts, ", ")), nil
+}
+
+func init() {
+	config.Register(config.Setting{Key: "ADMIN_USERS", Description: "Comma separated source:user pairs that are admins in every source, e.g. irc:#channel:nick", Validate: validAdminUsers})
+
+	Register(Handler{
+		Name:     "grant",
+		Summary:  "Give a user a role in a source",
+		Usage:    "grant <user> <banned|normal|trusted|admin> [source|here|*]",
+		Examples: []string{"grant nick trusted", "grant spammer banned #channel", "grant nick admin *"},
+		Category: "admin",
+		MinRole:  role.Admin,
+		Func:     Grant,
+	})
+	Register(Handler{
+		Name:     "revoke",
+		Summary:  "Remove the role of a user in a source",
+		Usage:    "revoke <user> [source|here|*]",
+		Examples: []string{"revoke nick", "revoke nick *"},
+		Category: "admin",
+		MinRole:  role.Admin,
+		Func:     Revoke,
+	})
+	Register(Handler{
+		Name:     "roles",
+		Summary:  "List the roles assigned in a source",
+		Usage:    "roles [source|here|*]",
+		Examples: []string{"roles", "roles *"},
+		Category: "admin",
+		MinRole:  role.Admin,
+		Func:     Roles,
+	})
+}
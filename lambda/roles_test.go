@@ -0,0 +1,142 @@
+package lambda
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lepinkainen/lambdabot/role"
+)
+
+func TestHandleRequestRoles(t *testing.T) {
+	SetRoleStore(role.NewMemoryStore())
+	defer SetRoleStore(nil)
+	t.Setenv("ADMIN_USERS", "#channel:boss")
+
+	RegisterContextHandler("secret", func(context.Context, *Command) (string, error) {
+		return "hidden", nil
+	})
+	handlers["secret"].MinRole = role.Trusted
+	defer delete(handlers, "secret")
+
+	run := func(user, command, args string) *Command {
+		got, _ := HandleRequest(context.Background(), &Command{User: user, Source: "#channel", Command: command, Arguments: args})
+		return got
+	}
+
+	tests := []struct {
+		name    string
+		user    string
+		command string
+		args    string
+		want    string
+		code    string
+	}{
+		{"normal user", "nick", "secret", "", "secret is limited to trusted users", ErrorForbidden},
+		{"normal user grants", "nick", "grant", "nick admin", "grant is limited to admin users", ErrorForbidden},
+		{"admin grants trusted", "boss", "grant", "nick trusted", "nick is now trusted in #channel", ""},
+		{"trusted user", "nick", "secret", "", "hidden", ""},
+		{"admin bans", "boss", "grant", "spammer banned", "spammer is now banned in #channel", ""},
+		{"banned user", "spammer", "echo", "hello", "", ErrorBanned},
+		{"banned user unknown command", "spammer", "ehco", "", "", ErrorBanned},
+		{"admin lists", "boss", "roles", "", "Roles in #channel: nick: trusted, spammer: banned", ""},
+		{"admin revokes", "boss", "revoke", "nick", "Revoked role of nick in #channel", ""},
+		{"revoked user", "nick", "secret", "", "secret is limited to trusted users", ErrorForbidden},
+		{"unknown role", "boss", "grant", "nick owner", `unknown role "owner", use banned, normal, trusted or admin`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := run(tt.user, tt.command, tt.args)
+			if got.Result != tt.want || got.ErrorCode != tt.code {
+				t.Errorf("HandleRequest() = '%v' (%v), want '%v' (%v)", got.Result, got.ErrorCode, tt.want, tt.code)
+			}
+		})
+	}
+}
+
+func TestGrantOtherSources(t *testing.T) {
+	store := role.NewMemoryStore()
+	SetRoleStore(store)
+	defer SetRoleStore(nil)
+	t.Setenv("ADMIN_USERS", "#channel:boss")
+
+	ctx := context.Background()
+	_ = store.Set(ctx, "#channel", "op", role.Admin)
+	_ = store.Set(ctx, "#other", "op", role.Admin)
+	_ = store.Set(ctx, role.AnySource, "global", role.Admin)
+
+	run := func(user, command, args string) string {
+		got, _ := HandleRequest(ctx, &Command{User: user, Source: "#channel", Command: command, Arguments: args})
+		return got.Result
+	}
+
+	tests := []struct {
+		name    string
+		user    string
+		command string
+		args    string
+		want    string
+	}{
+		{"channel admin in own source", "op", "grant", "nick trusted here", "nick is now trusted in #channel"},
+		{"channel admin in source they admin", "op", "grant", "nick trusted #other", "nick is now trusted in #other"},
+		{"channel admin in another source", "op", "grant", "nick trusted #elsewhere", "Only admins in #elsewhere can change roles there"},
+		{"channel admin everywhere", "op", "grant", "op admin *", "Only admins in * can change roles there"},
+		{"channel admin revokes everywhere", "op", "revoke", "global *", "Only admins in * can change roles there"},
+		{"global admin everywhere", "global", "grant", "nick trusted *", "nick is now trusted in *"},
+		{"global admin in another source", "global", "revoke", "nick #other", "Revoked role of nick in #other"},
+		{"bootstrap admin everywhere", "boss", "revoke", "nick *", "Revoked role of nick in *"},
+		{"channel admin lists source they admin", "op", "roles", "#other", "Roles in #other: op: admin"},
+		{"channel admin lists another source", "op", "roles", "#elsewhere", "Only admins in #elsewhere can see roles there"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := run(tt.user, tt.command, tt.args); got != tt.want {
+				t.Errorf("HandleRequest() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+
+	if r, _ := role.Resolve(ctx, store, "#elsewhere", "op"); r != role.Normal {
+		t.Errorf("role of op in #elsewhere = %v, want normal", r)
+	}
+}
+
+func TestBootstrapAdminSource(t *testing.T) {
+	SetRoleStore(role.NewMemoryStore())
+	defer SetRoleStore(nil)
+	t.Setenv("ADMIN_USERS", "irc:#channel:boss")
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"irc:#channel", "Roles in *: nick: trusted"},
+		// the same nick in another source isn't the admin
+		{"irc:#other", "roles is limited to admin users"},
+		{"slack:#channel", "roles is limited to admin users"},
+	}
+	_ = roles().Set(context.Background(), role.AnySource, "nick", role.Trusted)
+	for _, tt := range tests {
+		got, _ := HandleRequest(context.Background(), &Command{User: "boss", Source: tt.source, Command: "roles", Arguments: "*"})
+		if got.Result != tt.want {
+			t.Errorf("HandleRequest() in %s = '%v', want '%v'", tt.source, got.Result, tt.want)
+		}
+	}
+}
+
+func TestValidAdminUsers(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"#channel:boss", false},
+		{"irc:#channel:boss, slack:C123:U456", false},
+		{"boss", true},
+		{"#channel:", true},
+		{":boss", true},
+	}
+	for _, tt := range tests {
+		if err := validAdminUsers(tt.value); (err != nil) != tt.wantErr {
+			t.Errorf("validAdminUsers(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+		}
+	}
+}
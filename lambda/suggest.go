@@ -0,0 +1,123 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lepinkainen/lambdabot/config"
+)
+
+// maxSuggestions is the maximum number of "did you mean" candidates shown
+const maxSuggestions = 3
+
+// suggestionsEnabled reports whether unknown commands from the source should get a reply.
+// SUGGEST_QUIET_SOURCES lists the sources that don't, a single "*" silences every source.
+func suggestionsEnabled(source string) bool {
+	quiet := config.List("SUGGEST_QUIET_SOURCES")
+	return !slices.Contains(quiet, "*") && !slices.Contains(quiet, source)
+}
+
+// unknownCommandResponse returns a "did you mean" reply for an unknown command,
+// or an empty string if nothing is close enough or the source is quiet
+func unknownCommandResponse(ctx context.Context, cmd *Command) string {
+	if !suggestionsEnabled(cmd.Source) {
+		return ""
+	}
+
+	suggestions := Suggest(ctx, cmd)
+	if len(suggestions) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("Unknown command '%s', did you mean: %s?", cmd.Command, strings.Join(suggestions, ", "))
+}
+
+// Suggest returns registered command names and aliases close to the command, best match first.
+// Like help, it leaves out commands that are disabled in the source or above the caller's role.
+func Suggest(ctx context.Context, cmd *Command) []string {
+	typed := cmd.Command
+	command := strings.ToLower(typed)
+	if command == "" {
+		return nil
+	}
+
+	rules := loadPolicyRules(ctx)
+	callerRole := userRole(ctx, cmd)
+
+	limit := maxDistance(command)
+
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+
+	for _, name := range Names() {
+		// a name that only differs in case is still worth suggesting
+		d := editDistance(command, name)
+		if d > limit || typed == name {
+			continue
+		}
+		if h, ok := Lookup(name); !ok || !allowedBy(rules, h, cmd.Source) || callerRole < h.MinRole {
+			continue
+		}
+		candidates = append(candidates, candidate{name, d})
+	}
+
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return a.distance - b.distance
+	})
+
+	var suggestions []string
+	for _, c := range candidates[:min(len(candidates), maxSuggestions)] {
+		suggestions = append(suggestions, c.name)
+	}
+	return suggestions
+}
+
+// maxDistance is the largest edit distance still considered a typo, short commands allow fewer edits
+func maxDistance(command string) int {
+	switch n := len([]rune(command)); {
+	case n <= 2:
+		return 0
+	case n <= 4:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance is the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and transpositions of adjacent runes each cost one
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// d[i][j] is the distance between the first i runes of a and the first j runes of b
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+
+			// transposition, "wetaher" -> "weather"
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return d[len(ra)][len(rb)]
+}
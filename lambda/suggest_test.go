@@ -0,0 +1,115 @@
+package lambda
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/lepinkainen/lambdabot/policy"
+	"github.com/lepinkainen/lambdabot/role"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"weather", "weather", 0},
+		{"wether", "weather", 1},
+		{"wetaher", "weather", 1},
+		{"sahk", "sahko", 1},
+		{"säkö", "sahko", 3},
+		{"", "ep", 2},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	noop := func(context.Context, *Command) (string, error) { return "", nil }
+	Register(Handler{Name: "testweather", Aliases: []string{"testforecast"}, Func: noop})
+	Register(Handler{Name: "testsahko", Func: noop})
+	defer func() {
+		delete(handlers, "testweather")
+		delete(handlers, "testforecast")
+		delete(handlers, "testsahko")
+	}()
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{"testwether", "testweather"},
+		{"testforcast", "testforecast"},
+		{"testsahk", "testsahko"},
+		{"TESTSAHK", "testsahko"},
+		{"TESTSAHKO", "testsahko"},
+	}
+	for _, tt := range tests {
+		if got := Suggest(context.Background(), &Command{Command: tt.command}); !slices.Contains(got, tt.want) {
+			t.Errorf("Suggest(%q) = %v, want it to contain %q", tt.command, got, tt.want)
+		}
+	}
+
+	if got := Suggest(context.Background(), &Command{Command: "completelyunrelated"}); len(got) != 0 {
+		t.Errorf("Suggest(completelyunrelated) = %v, want none", got)
+	}
+}
+
+func TestUnknownCommandResponse(t *testing.T) {
+	noop := func(context.Context, *Command) (string, error) { return "", nil }
+	Register(Handler{Name: "testweather", Func: noop})
+	defer delete(handlers, "testweather")
+
+	t.Setenv("SUGGEST_QUIET_SOURCES", "#quiet, #other")
+
+	got, err := HandleRequest(context.Background(), &Command{Source: "#loud", Command: "testwether"})
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if want := "Unknown command 'testwether', did you mean: testweather?"; got.Result != want {
+		t.Errorf("HandleRequest() = '%v', want '%v'", got.Result, want)
+	}
+
+	got, err = HandleRequest(context.Background(), &Command{Source: "#quiet", Command: "testwether"})
+	if err != nil {
+		t.Fatalf("HandleRequest() error = %v", err)
+	}
+	if got.Result != "" {
+		t.Errorf("HandleRequest() = '%v', want empty result for a quiet source", got.Result)
+	}
+}
+
+func TestSuggestHidesUnavailable(t *testing.T) {
+	SetPolicyStore(policy.NewMemoryStore())
+	defer SetPolicyStore(nil)
+	t.Setenv("POLICY_RULES", `[{"source": "#quiet", "command": "testweather", "allow": false}]`)
+
+	noop := func(context.Context, *Command) (string, error) { return "", nil }
+	Register(Handler{Name: "testweather", Func: noop})
+	Register(Handler{Name: "testgrant", MinRole: role.Admin, Func: noop})
+	defer func() {
+		delete(handlers, "testweather")
+		delete(handlers, "testgrant")
+	}()
+
+	tests := []struct {
+		source  string
+		command string
+		want    []string
+	}{
+		{"#quiet", "testwether", nil},
+		{"#other", "testwether", []string{"testweather"}},
+		// a normal user isn't offered admin commands
+		{"#other", "testgrnt", nil},
+	}
+	for _, tt := range tests {
+		got := Suggest(context.Background(), &Command{Source: tt.source, User: "nick", Command: tt.command})
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Suggest(%q) in %s = %v, want %v", tt.command, tt.source, got, tt.want)
+		}
+	}
+}
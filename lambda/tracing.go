@@ -0,0 +1,165 @@
+package lambda
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/lepinkainen/lambdabot/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tracerName is the instrumentation scope of the spans started here
+const tracerName = "github.com/lepinkainen/lambdabot/lambda"
+
+// flushTimeout limits how long exporting the spans of a request can take
+const flushTimeout = 2 * time.Second
+
+var (
+	tracingOnce sync.Once
+	// tracerProvider is the provider set up from TRACING_EXPORTER, nil when tracing is off
+	tracerProvider *sdktrace.TracerProvider
+)
+
+func init() {
+	config.Register(config.Setting{Key: "TRACING_EXPORTER", Description: "none, stdout or otlp, default none", Validate: validExporter})
+	config.Register(config.Setting{Key: "OTEL_EXPORTER_OTLP_ENDPOINT", Description: "OpenTelemetry collector for the otlp exporter, default http://localhost:4318"})
+	config.Register(config.Setting{Key: "OTEL_SERVICE_NAME", Description: "Service name of exported spans, default lambdabot"})
+
+	// spans aren't recorded until an exporter is configured
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	// trace IDs in every log line written with the request context
+	log.AddHook(traceLogHook{})
+}
+
+func validExporter(value string) error {
+	switch strings.ToLower(value) {
+	case "none", "stdout", "otlp":
+		return nil
+	}
+	return fmt.Errorf("unknown exporter %q, use none, stdout or otlp", value)
+}
+
+// initTracing sets up the exporter chosen with TRACING_EXPORTER on first use.
+// Nothing is changed when it isn't set, so tests can set their own provider.
+func initTracing() {
+	tracingOnce.Do(func() {
+		var option sdktrace.TracerProviderOption
+		switch strings.ToLower(config.Get("TRACING_EXPORTER")) {
+		case "stdout":
+			exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+			if err != nil {
+				log.Warnf("Unable to create the stdout span exporter, tracing disabled: %v", err)
+				return
+			}
+			option = sdktrace.WithSyncer(exporter)
+		case "otlp":
+			endpoint := config.Get("OTEL_EXPORTER_OTLP_ENDPOINT")
+			if endpoint == "" {
+				endpoint = "http://localhost:4318"
+			}
+			exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(strings.TrimSuffix(endpoint, "/")+"/v1/traces"))
+			if err != nil {
+				log.Warnf("Unable to create the OTLP span exporter, tracing disabled: %v", err)
+				return
+			}
+			option = sdktrace.WithBatcher(exporter)
+		default:
+			return
+		}
+
+		service := config.Get("OTEL_SERVICE_NAME")
+		if service == "" {
+			service = "lambdabot"
+		}
+
+		tracerProvider = sdktrace.NewTracerProvider(option,
+			sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))))
+		otel.SetTracerProvider(tracerProvider)
+	})
+}
+
+// StartSpan starts a span with the global provider, a no-op one unless tracing is set up.
+// Handlers use it for the steps of their own, e.g. geocoding before the weather lookup.
+func StartSpan(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// EndSpan marks the span failed if err isn't nil and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// withTracing runs the dispatcher in a span of its own and exports the spans of the request afterwards.
+// Lambda freezes the process between invocations, so spans can't wait for a background export.
+func withTracing(ctx context.Context, cmd *Command, dispatch func(context.Context, *Command) (*Command, error)) (*Command, error) {
+	initTracing()
+
+	ctx, span := StartSpan(ctx, "HandleRequest", trace.SpanKindServer,
+		attribute.String("command", cmd.Command),
+		attribute.String("source", cmd.Source))
+
+	res, err := dispatch(ctx, cmd)
+
+	span.SetAttributes(attribute.String("error_code", cmd.ErrorCode))
+	EndSpan(span, err)
+
+	if tracerProvider != nil {
+		flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), flushTimeout)
+		defer cancel()
+		if err := tracerProvider.ForceFlush(flushCtx); err != nil {
+			log.WithContext(ctx).Warnf("Unable to export spans: %v", err)
+		}
+	}
+
+	return res, err
+}
+
+// extractTrace continues the trace of an incoming W3C traceparent header
+func extractTrace(ctx context.Context, header propagation.TextMapCarrier) context.Context {
+	return propagation.TraceContext{}.Extract(ctx, header)
+}
+
+// traceLogHook adds the trace and span IDs to log lines written with a context that has a span,
+// e.g. log.WithContext(ctx).Infof(...)
+type traceLogHook struct{}
+
+// Levels returns all levels, every log line can carry the IDs
+func (traceLogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire adds trace_id and span_id fields to the entry
+func (traceLogHook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	span := trace.SpanContextFromContext(entry.Context)
+	if !span.IsValid() {
+		return nil
+	}
+	entry.Data["trace_id"] = span.TraceID().String()
+	entry.Data["span_id"] = span.SpanID().String()
+	return nil
+}
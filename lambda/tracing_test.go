@@ -0,0 +1,103 @@
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// recordSpans makes the global provider keep finished spans in memory until the test ends
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return exporter
+}
+
+func TestHandleRequestTracing(t *testing.T) {
+	exporter := recordSpans(t)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stdout)
+
+	RegisterContextHandler("traced", func(ctx context.Context, cmd *Command) (string, error) {
+		log.WithContext(ctx).Info("inside handler")
+		return "", errors.New("broken")
+	})
+	defer delete(handlers, "traced")
+
+	_, _ = HandleRequest(context.Background(), &Command{Source: "#channel", Command: "traced"})
+
+	got := exporter.GetSpans()
+	if len(got) != 2 {
+		t.Fatalf("exported %d spans, want handler and HandleRequest", len(got))
+	}
+	handler, root := got[0], got[1]
+	if handler.Name != "handler traced" || root.Name != "HandleRequest" {
+		t.Errorf("span names = '%v', '%v'", handler.Name, root.Name)
+	}
+	if handler.Parent.SpanID() != root.SpanContext.SpanID() || handler.SpanContext.TraceID() != root.SpanContext.TraceID() {
+		t.Errorf("handler span isn't a child of HandleRequest")
+	}
+	if handler.Status.Code != codes.Error || root.Status.Code != codes.Error {
+		t.Errorf("handler status = %v, root status = %v, want both failed", handler.Status, root.Status)
+	}
+	if !hasAttribute(root.Attributes, attribute.String("error_code", ErrorHandler)) {
+		t.Errorf("root attributes = '%v', want error_code '%v'", root.Attributes, ErrorHandler)
+	}
+
+	// every log line of the request carries the trace ID
+	if logs.Len() == 0 {
+		t.Fatal("HandleRequest() didn't log anything")
+	}
+	for line := range strings.Lines(logs.String()) {
+		if !strings.Contains(line, `"trace_id":"`+root.SpanContext.TraceID().String()+`"`) {
+			t.Errorf("log line without trace ID: %s", line)
+		}
+	}
+}
+
+func TestHTTPHandlerContinuesTrace(t *testing.T) {
+	exporter := recordSpans(t)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(`{"command": "echo", "args": "hi"}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	NewHTTPHandler(time.Second).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) == 0 {
+		t.Fatal("HTTP handler didn't export any spans")
+	}
+	root := spans[len(spans)-1]
+	if root.SpanContext.TraceID().String() != traceID || root.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("root span %v/%v doesn't continue the traceparent", root.SpanContext.TraceID(), root.Parent.SpanID())
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, a := range attrs {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
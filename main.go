@@ -8,28 +8,51 @@ import (
 
 	// fake import for commands to run their init() functions
 	_ "github.com/lepinkainen/lambdabot/command"
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/httpclient"
 	"github.com/lepinkainen/lambdabot/lambda"
 
 	awslambda "github.com/aws/aws-lambda-go/lambda"
+	log "github.com/sirupsen/logrus"
 )
 
+// Version is set at build time with -ldflags="-X main.Version=..."
+var Version = "dev"
+
 func main() {
-	if os.Getenv("RUNMODE") == "stdout" {
+	httpclient.SetVersion(Version)
+
+	// lambdabot config check
+	if len(os.Args) == 3 && os.Args[1] == "config" && os.Args[2] == "check" {
+		os.Exit(runConfigCheck(os.Stdout))
+	}
+
+	if err := config.Load(); err != nil {
+		log.Errorf("%v", err)
+	}
+
+	switch config.Get("RUNMODE") {
+	case "stdout":
 		runLocal()
-	} else {
-		awslambda.Start(lambda.HandleRequest)
+	case "http":
+		runHTTP()
+	case "repl":
+		runREPL()
+	default:
+		awslambda.Start(lambda.HandlePayload)
 	}
 }
 
+// runLocal reads a single command or an array of commands from stdin
 func runLocal() {
-	var cmd lambda.Command
+	var payload json.RawMessage
 	decoder := json.NewDecoder(os.Stdin)
-	if err := decoder.Decode(&cmd); err != nil {
+	if err := decoder.Decode(&payload); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing JSON input: %v\n", err)
 		os.Exit(1)
 	}
 
-	result, err := lambda.HandleRequest(context.Background(), &cmd)
+	result, err := lambda.HandlePayload(context.Background(), payload)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error handling request: %v\n", err)
 		os.Exit(1)
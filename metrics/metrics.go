@@ -0,0 +1,165 @@
+// Package metrics writes CloudWatch Embedded Metric Format records.
+// Lambda ships anything written to stdout to CloudWatch Logs, which turns EMF records into metrics.
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"sync"
+	"time"
+)
+
+// Unit of a metric value, see the CloudWatch MetricDatum docs for all units
+type Unit string
+
+// Units used by the bot
+const (
+	Count        Unit = "Count"
+	Milliseconds Unit = "Milliseconds"
+)
+
+// Metric is a single named value of a record
+type Metric struct {
+	Name  string
+	Unit  Unit
+	Value float64
+}
+
+// Record is one EMF log line with its dimensions, metrics and extra properties
+type Record struct {
+	// Dimensions are the dimension values, every name in DimensionSets needs a value
+	Dimensions map[string]string
+	// DimensionSets are the combinations of dimensions the metrics are aggregated by
+	DimensionSets [][]string
+	// Properties are logged with the record but aren't dimensions, e.g. a cold start flag
+	Properties map[string]any
+	Metrics    []Metric
+}
+
+// Emitter writes records to a writer, one JSON object per line
+type Emitter struct {
+	namespace string
+	now       func() time.Time
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New returns an emitter writing records in the namespace to w
+func New(w io.Writer, namespace string) *Emitter {
+	return &Emitter{namespace: namespace, now: time.Now, w: w}
+}
+
+type metricDefinition struct {
+	Name string `json:"Name"`
+	Unit Unit   `json:"Unit"`
+}
+
+type metricDirective struct {
+	Namespace  string             `json:"Namespace"`
+	Dimensions [][]string         `json:"Dimensions"`
+	Metrics    []metricDefinition `json:"Metrics"`
+}
+
+type metadata struct {
+	Timestamp         int64             `json:"Timestamp"`
+	CloudWatchMetrics []metricDirective `json:"CloudWatchMetrics"`
+}
+
+// Emit writes the record, EMF keeps dimensions, properties and metric values as top-level keys
+func (e *Emitter) Emit(r Record) error {
+	body := make(map[string]any, len(r.Dimensions)+len(r.Properties)+len(r.Metrics)+1)
+	maps.Copy(body, r.Properties)
+	for k, v := range r.Dimensions {
+		body[k] = v
+	}
+
+	directive := metricDirective{
+		Namespace:  e.namespace,
+		Dimensions: r.DimensionSets,
+		Metrics:    make([]metricDefinition, len(r.Metrics)),
+	}
+	if directive.Dimensions == nil {
+		directive.Dimensions = [][]string{}
+	}
+	for i, m := range r.Metrics {
+		directive.Metrics[i] = metricDefinition{Name: m.Name, Unit: m.Unit}
+		body[m.Name] = m.Value
+	}
+
+	body["_aws"] = metadata{
+		Timestamp:         e.now().UnixMilli(),
+		CloudWatchMetrics: []metricDirective{directive},
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+// Upstream collects the time spent calling external services while handling a command
+type Upstream struct {
+	mu       sync.Mutex
+	services map[string]*UpstreamStats
+}
+
+// UpstreamStats is the number of calls to a service and their total duration
+type UpstreamStats struct {
+	Calls    int
+	Duration time.Duration
+}
+
+type upstreamKey struct{}
+
+// WithUpstream returns a context that collects upstream calls made with it
+func WithUpstream(ctx context.Context) (context.Context, *Upstream) {
+	u := &Upstream{services: make(map[string]*UpstreamStats)}
+	return context.WithValue(ctx, upstreamKey{}, u), u
+}
+
+// RecordUpstream adds a call to the service to the collector of the context, if there is one
+func RecordUpstream(ctx context.Context, service string, d time.Duration) {
+	u, ok := ctx.Value(upstreamKey{}).(*Upstream)
+	if !ok {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	s, ok := u.services[service]
+	if !ok {
+		s = &UpstreamStats{}
+		u.services[service] = s
+	}
+	s.Calls++
+	s.Duration += d
+}
+
+// Services returns a copy of the collected stats by service
+func (u *Upstream) Services() map[string]UpstreamStats {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	services := make(map[string]UpstreamStats, len(u.services))
+	for name, s := range u.services {
+		services[name] = *s
+	}
+	return services
+}
+
+// Total returns the time spent in all services
+func (u *Upstream) Total() time.Duration {
+	var total time.Duration
+	for _, s := range u.Services() {
+		total += s.Duration
+	}
+	return total
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEmit(t *testing.T) {
+	var buf bytes.Buffer
+	e := New(&buf, "Test")
+	e.now = func() time.Time { return time.UnixMilli(1700000000000) }
+
+	err := e.Emit(Record{
+		Dimensions:    map[string]string{"Command": "ep", "Source": "#channel"},
+		DimensionSets: [][]string{{"Command", "Source"}, {"Command"}},
+		Properties:    map[string]any{"ColdStart": true},
+		Metrics: []Metric{
+			{Name: "Invocations", Unit: Count, Value: 1},
+			{Name: "Latency", Unit: Milliseconds, Value: 12.5},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Emit() error = %v", err)
+	}
+
+	want := `{"ColdStart":true,"Command":"ep","Invocations":1,"Latency":12.5,"Source":"#channel",` +
+		`"_aws":{"Timestamp":1700000000000,"CloudWatchMetrics":[{"Namespace":"Test","Dimensions":[["Command","Source"],["Command"]],` +
+		`"Metrics":[{"Name":"Invocations","Unit":"Count"},{"Name":"Latency","Unit":"Milliseconds"}]}]}}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Emit() = '%v', want '%v'", got, want)
+	}
+
+	if !json.Valid(bytes.TrimSpace(buf.Bytes())) {
+		t.Error("Emit() wrote invalid JSON")
+	}
+}
+
+func TestUpstream(t *testing.T) {
+	// no collector, nothing happens
+	RecordUpstream(context.Background(), "tvmaze", time.Second)
+
+	ctx, u := WithUpstream(context.Background())
+	RecordUpstream(ctx, "tvmaze", 100*time.Millisecond)
+	RecordUpstream(ctx, "tvmaze", 50*time.Millisecond)
+	RecordUpstream(ctx, "entsoe", 20*time.Millisecond)
+
+	services := u.Services()
+	if got := services["tvmaze"]; got.Calls != 2 || got.Duration != 150*time.Millisecond {
+		t.Errorf("Services()[tvmaze] = %+v, want 2 calls in 150ms", got)
+	}
+	if got := u.Total(); got != 170*time.Millisecond {
+		t.Errorf("Total() = %v, want 170ms", got)
+	}
+}
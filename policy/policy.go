@@ -0,0 +1,196 @@
+// Package policy decides which commands may run in which sources
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Any matches every source or command in a rule
+const Any = "*"
+
+// Rule allows or denies a command in a source, either can be Any
+type Rule struct {
+	Source  string `json:"source"`
+	Command string `json:"command"`
+	Allow   bool   `json:"allow"`
+}
+
+func (r Rule) String() string {
+	action := "deny"
+	if r.Allow {
+		action = "allow"
+	}
+	return fmt.Sprintf("%s %s %s", action, r.Source, r.Command)
+}
+
+// specificity ranks how closely the rule matches, zero if it doesn't match at all.
+// An exact source beats an exact command, so a source can opt back in to a command denied everywhere.
+func (r Rule) specificity(source, command string) int {
+	sourceMatch := r.Source == source
+	commandMatch := r.Command == command
+	if (!sourceMatch && r.Source != Any) || (!commandMatch && r.Command != Any) {
+		return 0
+	}
+
+	switch {
+	case sourceMatch && commandMatch:
+		return 4
+	case sourceMatch:
+		return 3
+	case commandMatch:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// Allowed evaluates the rules for a command in a source. The most specific matching rule wins,
+// from most to least specific: source and command, source and any command, any source and command, any and any.
+// Of equally specific rules the last one wins. Without a matching rule everything is allowed.
+func Allowed(rules []Rule, source, command string) bool {
+	allowed, best := true, 0
+	for _, r := range rules {
+		if s := r.specificity(source, command); s > 0 && s >= best {
+			allowed, best = r.Allow, s
+		}
+	}
+	return allowed
+}
+
+// Set replaces any rule for the same source and command with the given one
+func Set(rules []Rule, rule Rule) []Rule {
+	rules = Remove(rules, rule.Source, rule.Command)
+	return append(rules, rule)
+}
+
+// Remove drops the rule for the source and command
+func Remove(rules []Rule, source, command string) []Rule {
+	return slices.DeleteFunc(slices.Clone(rules), func(r Rule) bool {
+		return r.Source == source && r.Command == command
+	})
+}
+
+// Parse reads rules from JSON, e.g. [{"source": "*", "command": "wa", "allow": false}]
+func Parse(data string) ([]Rule, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal([]byte(data), &rules); err != nil {
+		return nil, fmt.Errorf("invalid policy rules: %v", err)
+	}
+	for _, r := range rules {
+		if r.Source == "" || r.Command == "" {
+			return nil, fmt.Errorf("invalid policy rule %v: source and command are required", r)
+		}
+	}
+	return rules, nil
+}
+
+// Store keeps the rules edited at runtime
+type Store interface {
+	Load(ctx context.Context) ([]Rule, error)
+	// Update replaces the rules with what edit returns for the current ones, as a single atomic change
+	Update(ctx context.Context, edit func(rules []Rule) []Rule) error
+}
+
+// MemoryStore keeps rules in process memory
+type MemoryStore struct {
+	mu    sync.Mutex
+	rules []Rule
+}
+
+// NewMemoryStore returns an empty in-memory rule store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Load returns a copy of the stored rules
+func (m *MemoryStore) Load(context.Context) ([]Rule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.rules), nil
+}
+
+// Update edits the stored rules while holding the lock
+func (m *MemoryStore) Update(_ context.Context, edit func(rules []Rule) []Rule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = slices.Clone(edit(slices.Clone(m.rules)))
+	return nil
+}
+
+// redisKey holds the rules as a JSON array
+const redisKey = "policy:rules"
+
+// maxUpdateAttempts limits the retries when other instances keep changing the rules during an update
+const maxUpdateAttempts = 5
+
+// ErrConflict is returned when the rules kept changing during every attempt of an update
+var ErrConflict = errors.New("policy rules were changed concurrently, try again")
+
+// RedisClient is the part of the Redis client the store needs, transactions need WATCH
+type RedisClient interface {
+	redis.Cmdable
+	Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error
+}
+
+// RedisStore keeps rules in Redis so edits apply to every Lambda instance at once
+type RedisStore struct {
+	client RedisClient
+}
+
+// NewRedisStore returns a store keeping the rules in the given Redis
+func NewRedisStore(client RedisClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Load reads the rules, no key means no rules
+func (r *RedisStore) Load(ctx context.Context) ([]Rule, error) {
+	return loadRedis(ctx, r.client)
+}
+
+func loadRedis(ctx context.Context, client redis.Cmdable) ([]Rule, error) {
+	data, err := client.Get(ctx, redisKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Update edits the rules in a WATCH/MULTI transaction, so edits made at the same time on other instances aren't lost.
+// The edit is retried on the new rules if they changed before the write.
+func (r *RedisStore) Update(ctx context.Context, edit func(rules []Rule) []Rule) error {
+	for range maxUpdateAttempts {
+		err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+			rules, err := loadRedis(ctx, tx)
+			if err != nil {
+				return err
+			}
+			data, err := json.Marshal(edit(rules))
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				return pipe.Set(ctx, redisKey, data, 0).Err()
+			})
+			return err
+		}, redisKey)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return ErrConflict
+}
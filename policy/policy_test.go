@@ -0,0 +1,97 @@
+package policy
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAllowed(t *testing.T) {
+	rules := []Rule{
+		// wa is a paid API, only #paid may use it
+		{Source: Any, Command: "wa", Allow: false},
+		{Source: "#paid", Command: "wa", Allow: true},
+		// #quiet only has sahko and weather
+		{Source: "#quiet", Command: Any, Allow: false},
+		{Source: "#quiet", Command: "sahko", Allow: true},
+		{Source: "#quiet", Command: "weather", Allow: true},
+		// #open allows everything, even wa
+		{Source: "#open", Command: Any, Allow: true},
+	}
+
+	tests := []struct {
+		source, command string
+		want            bool
+	}{
+		{"#random", "ep", true},
+		{"#random", "wa", false},
+		{"#paid", "wa", true},
+		{"#quiet", "sahko", true},
+		{"#quiet", "weather", true},
+		{"#quiet", "ep", false},
+		{"#quiet", "wa", false},
+		{"#open", "wa", true},
+	}
+	for _, tt := range tests {
+		if got := Allowed(rules, tt.source, tt.command); got != tt.want {
+			t.Errorf("Allowed(%s, %s) = %v, want %v", tt.source, tt.command, got, tt.want)
+		}
+	}
+
+	if !Allowed(nil, "#any", "ep") {
+		t.Error("Allowed() without rules = false, want true")
+	}
+}
+
+func TestSetRemove(t *testing.T) {
+	rules := Set(nil, Rule{Source: "#a", Command: "wa", Allow: false})
+	rules = Set(rules, Rule{Source: "#a", Command: "wa", Allow: true})
+	if len(rules) != 1 || !rules[0].Allow {
+		t.Fatalf("Set() = %v, want a single allow rule", rules)
+	}
+
+	rules = Remove(rules, "#a", "wa")
+	if len(rules) != 0 {
+		t.Errorf("Remove() = %v, want no rules", rules)
+	}
+}
+
+func TestParse(t *testing.T) {
+	rules, err := Parse(`[{"source": "*", "command": "wa", "allow": false}]`)
+	if err != nil || len(rules) != 1 || rules[0] != (Rule{Source: Any, Command: "wa"}) {
+		t.Errorf("Parse() = %v, %v", rules, err)
+	}
+
+	if _, err := Parse(`[{"command": "wa"}]`); err == nil {
+		t.Error("Parse() accepted a rule without a source")
+	}
+
+	if rules, err := Parse(""); err != nil || rules != nil {
+		t.Errorf("Parse(\"\") = %v, %v, want no rules", rules, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+	rules := []Rule{{Source: "#a", Command: "wa"}}
+	_ = store.Update(context.Background(), func([]Rule) []Rule { return rules })
+
+	// the store keeps its own copy
+	rules[0].Allow = true
+	got, _ := store.Load(context.Background())
+	if len(got) != 1 || got[0].Allow {
+		t.Errorf("Load() = %v, want the saved rule unchanged", got)
+	}
+}
+
+func TestMemoryStoreUpdate(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	_ = store.Update(ctx, func(rules []Rule) []Rule { return Set(rules, Rule{Source: "#a", Command: "wa"}) })
+	_ = store.Update(ctx, func(rules []Rule) []Rule { return Set(rules, Rule{Source: "#b", Command: "wa", Allow: true}) })
+
+	got, _ := store.Load(ctx)
+	if len(got) != 2 {
+		t.Errorf("Load() = %v, want both edits", got)
+	}
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryStore keeps buckets in process memory, the limits only hold within a single instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// now is replaceable for tests
+	now func() time.Time
+}
+
+// NewMemoryStore returns an empty in-memory bucket store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the bucket at key
+func (m *MemoryStore) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	denied, retryAfter, err := m.AllowAll(ctx, []Bucket{{Key: key, Limit: limit}})
+	return denied < 0, retryAfter, err
+}
+
+// AllowAll takes a token from every bucket if all of them have one
+func (m *MemoryStore) AllowAll(_ context.Context, buckets []Bucket) (int, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	indexes := limited(buckets)
+	states := make([]*bucket, len(indexes))
+
+	for i, index := range indexes {
+		limit := buckets[index].Limit
+		b, ok := m.buckets[buckets[index].Key]
+		if !ok {
+			b = &bucket{tokens: float64(limit.Burst), last: now}
+			m.buckets[buckets[index].Key] = b
+		}
+
+		// refill for the time passed since the last request
+		interval := limit.interval()
+		b.tokens = min(float64(limit.Burst), b.tokens+float64(now.Sub(b.last))/float64(interval))
+		b.last = now
+
+		if b.tokens < 1 {
+			return index, time.Duration((1 - b.tokens) * float64(interval)), nil
+		}
+		states[i] = b
+	}
+
+	for _, b := range states {
+		b.tokens--
+	}
+	return -1, 0, nil
+}
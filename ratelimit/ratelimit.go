@@ -0,0 +1,87 @@
+// Package ratelimit implements token bucket rate limits with Redis and in-memory backends
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket holding Burst tokens, refilled completely over Period.
+// A zero Limit doesn't limit anything.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+// Unlimited reports whether the limit allows everything
+func (l Limit) Unlimited() bool {
+	return l.Burst <= 0 || l.Period <= 0
+}
+
+// String formats the limit like ParseLimit expects, e.g. "5/1m0s"
+func (l Limit) String() string {
+	if l.Unlimited() {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d/%s", l.Burst, l.Period)
+}
+
+// interval is the time it takes to refill a single token
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Burst)
+}
+
+// ParseLimit parses limits like "5/1m" (five requests per minute) or "100/24h"
+func ParseLimit(s string) (Limit, error) {
+	burst, period, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected <count>/<duration>", s)
+	}
+
+	n, err := strconv.Atoi(burst)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid count in limit %q", s)
+	}
+	// a zero count would mean no limit at all, not a blocked command
+	if n == 0 {
+		return Limit{}, fmt.Errorf("zero count in limit %q, disable commands with POLICY_RULES instead", s)
+	}
+
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid duration in limit %q", s)
+	}
+
+	return Limit{Burst: n, Period: d}, nil
+}
+
+// Bucket is the token bucket at Key holding up to Limit
+type Bucket struct {
+	Key   string
+	Limit Limit
+}
+
+// Store keeps token buckets
+type Store interface {
+	// Allow takes a token from the bucket at key. If the bucket is empty it returns false
+	// and the time until the next token is available.
+	Allow(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+	// AllowAll takes a token from every bucket, but only if all of them have one.
+	// Otherwise nothing is taken and it returns the index of the first empty bucket
+	// and the time until it has a token again. The index is -1 when allowed.
+	AllowAll(ctx context.Context, buckets []Bucket) (denied int, retryAfter time.Duration, err error)
+}
+
+// limited returns the indexes of the buckets that have a limit, unlimited ones never need a token
+func limited(buckets []Bucket) []int {
+	var res []int
+	for i, b := range buckets {
+		if !b.Limit.Unlimited() {
+			res = append(res, i)
+		}
+	}
+	return res
+}
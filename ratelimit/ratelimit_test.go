@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"5/1m", Limit{Burst: 5, Period: time.Minute}, false},
+		{" 100/24h ", Limit{Burst: 100, Period: 24 * time.Hour}, false},
+		{"0/1m", Limit{}, true},
+		{"5", Limit{}, true},
+		{"x/1m", Limit{}, true},
+		{"5/never", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	limit := Limit{Burst: 3, Period: time.Minute}
+
+	for i := range 3 {
+		if ok, _, _ := store.Allow(ctx, "user", limit); !ok {
+			t.Fatalf("request %d was throttled, want allowed", i+1)
+		}
+	}
+
+	ok, retry, _ := store.Allow(ctx, "user", limit)
+	if ok {
+		t.Fatal("fourth request was allowed, want throttled")
+	}
+	if retry != 20*time.Second {
+		t.Errorf("retryAfter = %v, want 20s", retry)
+	}
+
+	// other keys have their own buckets
+	if ok, _, _ := store.Allow(ctx, "other", limit); !ok {
+		t.Error("request with another key was throttled")
+	}
+
+	// one token is refilled every 20 seconds
+	now = now.Add(20 * time.Second)
+	if ok, _, _ := store.Allow(ctx, "user", limit); !ok {
+		t.Error("request after refill was throttled")
+	}
+	if ok, _, _ := store.Allow(ctx, "user", limit); ok {
+		t.Error("second request after a single refill was allowed")
+	}
+}
+
+func TestMemoryStoreUnlimited(t *testing.T) {
+	store := NewMemoryStore()
+	for range 100 {
+		if ok, _, _ := store.Allow(context.Background(), "user", Limit{}); !ok {
+			t.Fatal("unlimited request was throttled")
+		}
+	}
+}
+
+func TestMemoryStoreAllowAll(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	user := Bucket{Key: "user", Limit: Limit{Burst: 2, Period: time.Hour}}
+	source := Bucket{Key: "source", Limit: Limit{Burst: 1, Period: time.Hour}}
+
+	if denied, _, _ := store.AllowAll(ctx, []Bucket{user, source, {Key: "unlimited"}}); denied != -1 {
+		t.Fatalf("AllowAll() denied bucket %d, want allowed", denied)
+	}
+	if denied, retry, _ := store.AllowAll(ctx, []Bucket{user, source}); denied != 1 || retry <= 0 {
+		t.Errorf("AllowAll() = %d, %v, want the source bucket denied", denied, retry)
+	}
+
+	// the denied request didn't take the user's last token
+	if ok, _, _ := store.Allow(ctx, "user", user.Limit); !ok {
+		t.Error("user bucket was drained by a denied request")
+	}
+}
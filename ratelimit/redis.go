@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript refills the buckets and takes a token from each of them atomically,
+// but only if all of them have one.
+// A bucket is a hash of the remaining tokens and the last update time in milliseconds,
+// it expires once it would be full again.
+//
+// KEYS bucket keys
+// ARGV[1] current time in ms, then burst and refill interval of one token in ms for every key
+//
+// Returns {1-based index of the first empty bucket or 0 when allowed, retry after in ms}
+var tokenBucketScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local tokens = {}
+
+for i, key in ipairs(KEYS) do
+	local burst = tonumber(ARGV[i * 2])
+	local interval = tonumber(ARGV[i * 2 + 1])
+
+	local state = redis.call("HMGET", key, "tokens", "last")
+	local current = tonumber(state[1])
+	local last = tonumber(state[2])
+	if current == nil then
+		current = burst
+		last = now
+	end
+
+	current = math.min(burst, current + math.max(0, now - last) / interval)
+	if current < 1 then
+		return {i, math.ceil((1 - current) * interval)}
+	end
+	tokens[i] = current
+end
+
+for i, key in ipairs(KEYS) do
+	local burst = tonumber(ARGV[i * 2])
+	local interval = tonumber(ARGV[i * 2 + 1])
+	local left = tokens[i] - 1
+
+	redis.call("HSET", key, "tokens", tostring(left), "last", now)
+	redis.call("PEXPIRE", key, math.ceil((burst - left) * interval) + 1000)
+end
+
+return {0, 0}
+`)
+
+// RedisStore keeps buckets in Redis so the limits hold across Lambda invocations
+type RedisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisStore returns a store keeping buckets under "ratelimit:" in the given Redis
+func NewRedisStore(client redis.Scripter) *RedisStore {
+	return &RedisStore{client: client, prefix: "ratelimit:"}
+}
+
+// Allow takes a token from the bucket at key
+func (r *RedisStore) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	denied, retryAfter, err := r.AllowAll(ctx, []Bucket{{Key: key, Limit: limit}})
+	return denied < 0, retryAfter, err
+}
+
+// AllowAll takes a token from every bucket if all of them have one
+func (r *RedisStore) AllowAll(ctx context.Context, buckets []Bucket) (int, time.Duration, error) {
+	indexes := limited(buckets)
+	if len(indexes) == 0 {
+		return -1, 0, nil
+	}
+
+	keys := make([]string, len(indexes))
+	args := []any{time.Now().UnixMilli()}
+	for i, index := range indexes {
+		b := buckets[index]
+		keys[i] = r.prefix + b.Key
+		args = append(args, b.Limit.Burst, max(b.Limit.interval().Milliseconds(), 1))
+	}
+
+	res, err := tokenBucketScript.Run(ctx, r.client, keys, args...).Int64Slice()
+	if err != nil {
+		return -1, 0, err
+	}
+	if res[0] == 0 {
+		return -1, 0, nil
+	}
+	return indexes[res[0]-1], time.Duration(res[1]) * time.Millisecond, nil
+}
@@ -0,0 +1,176 @@
+// Package render formats result lines for the markup of each chat platform
+package render
+
+import (
+	"html"
+	"strings"
+)
+
+// Format is the markup of a chat platform
+type Format string
+
+// Supported formats, Plain is the fallback for everything else
+const (
+	Plain    Format = "plain"
+	IRC      Format = "irc"
+	Slack    Format = "slack"
+	Discord  Format = "discord"
+	Telegram Format = "telegram"
+	Matrix   Format = "matrix"
+)
+
+// Line is a platform neutral result line
+type Line struct {
+	Text string
+	// Title labels the link, the URL itself is shown if there's no title
+	Title string
+	URL   string
+	// Severity is "warning" or "error" for lines that should stand out, anything else is info
+	Severity string
+}
+
+// renderer describes the markup of one format
+type renderer struct {
+	separator string
+	escape    func(string) string
+	// link gets the label already escaped
+	link func(label, url string) string
+	// severities wrap the escaped text of warning and error lines
+	severities map[string]func(string) string
+}
+
+var renderers = map[Format]renderer{
+	Plain: {
+		separator: " | ",
+		escape:    noEscape,
+		link:      func(_, url string) string { return url },
+	},
+	IRC: {
+		separator: " | ",
+		escape:    noEscape,
+		link:      func(_, url string) string { return url },
+		severities: map[string]func(string) string{
+			// bold orange and bold red
+			"warning": wrap("\x02\x0307", "\x0F"),
+			"error":   wrap("\x02\x0304", "\x0F"),
+		},
+	},
+	Slack: {
+		separator: "\n",
+		escape:    strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace,
+		link: func(label, url string) string {
+			if label == "" {
+				return "<" + url + ">"
+			}
+			return "<" + url + "|" + label + ">"
+		},
+		severities: map[string]func(string) string{
+			"warning": wrap(":warning: *", "*"),
+			"error":   wrap(":x: *", "*"),
+		},
+	},
+	Discord: {
+		separator: "\n",
+		escape:    strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`).Replace,
+		link: func(label, url string) string {
+			// angle brackets keep Discord from embedding a preview of every link
+			if label == "" {
+				return "<" + url + ">"
+			}
+			return "[" + label + "](<" + url + ">)"
+		},
+		severities: map[string]func(string) string{
+			"warning": wrap("⚠️ **", "**"),
+			"error":   wrap("❌ **", "**"),
+		},
+	},
+	Telegram: {
+		separator: "\n",
+		escape:    html.EscapeString,
+		link:      htmlLink,
+		severities: map[string]func(string) string{
+			"warning": wrap("⚠️ <b>", "</b>"),
+			"error":   wrap("❌ <b>", "</b>"),
+		},
+	},
+	Matrix: {
+		separator: "<br>",
+		escape:    html.EscapeString,
+		link:      htmlLink,
+		severities: map[string]func(string) string{
+			"warning": wrap(`⚠️ <font data-mx-color="#ff8800"><b>`, "</b></font>"),
+			"error":   wrap(`❌ <font data-mx-color="#ff0000"><b>`, "</b></font>"),
+		},
+	},
+}
+
+func noEscape(s string) string {
+	return s
+}
+
+func wrap(before, after string) func(string) string {
+	return func(s string) string {
+		return before + s + after
+	}
+}
+
+// htmlLink gets the label already escaped
+func htmlLink(label, url string) string {
+	url = html.EscapeString(url)
+	if label == "" {
+		label = url
+	}
+	return `<a href="` + url + `">` + label + "</a>"
+}
+
+// ParseFormat returns the format with the given name, ok is false for unknown names
+func ParseFormat(name string) (Format, bool) {
+	f := Format(strings.ToLower(strings.TrimSpace(name)))
+	_, ok := renderers[f]
+	return f, ok
+}
+
+// Render formats the lines in the markup of the format, unknown formats render as Plain
+func Render(format Format, lines []Line) string {
+	return strings.Join(Lines(format, lines), Separator(format))
+}
+
+// Lines formats each line in the markup of the format without joining them
+func Lines(format Format, lines []Line) []string {
+	r := rendererFor(format)
+
+	out := make([]string, 0, len(lines))
+	for _, l := range lines {
+		out = append(out, r.line(l))
+	}
+	return out
+}
+
+// Separator joins rendered lines in one message of the format
+func Separator(format Format) string {
+	return rendererFor(format).separator
+}
+
+func rendererFor(format Format) renderer {
+	if r, ok := renderers[format]; ok {
+		return r
+	}
+	return renderers[Plain]
+}
+
+// line renders the text with its severity, followed by the link
+func (r renderer) line(l Line) string {
+	text := r.escape(l.Text)
+	if style, ok := r.severities[l.Severity]; ok && text != "" {
+		text = style(text)
+	}
+
+	if l.URL == "" {
+		return text
+	}
+	link := r.link(r.escape(l.Title), l.URL)
+	if text == "" {
+		return link
+	}
+	return text + " " + link
+}
@@ -0,0 +1,57 @@
+package render
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	lines := []Line{
+		{Text: "Next episode of The Mandalorian <3x01>", Title: "The Mandalorian", URL: "https://www.tvmaze.com/episodes/1?a=1&b=2"},
+		{Text: "Wind warning", Severity: "warning"},
+	}
+
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{Plain, "Next episode of The Mandalorian <3x01> https://www.tvmaze.com/episodes/1?a=1&b=2 | Wind warning"},
+		{IRC, "Next episode of The Mandalorian <3x01> https://www.tvmaze.com/episodes/1?a=1&b=2 | \x02\x0307Wind warning\x0F"},
+		{Slack, "Next episode of The Mandalorian &lt;3x01&gt; <https://www.tvmaze.com/episodes/1?a=1&b=2|The Mandalorian>\n:warning: *Wind warning*"},
+		{Discord, "Next episode of The Mandalorian <3x01> [The Mandalorian](<https://www.tvmaze.com/episodes/1?a=1&b=2>)\n⚠️ **Wind warning**"},
+		{Telegram, `Next episode of The Mandalorian &lt;3x01&gt; <a href="https://www.tvmaze.com/episodes/1?a=1&amp;b=2">The Mandalorian</a>` + "\n⚠️ <b>Wind warning</b>"},
+		{Matrix, `Next episode of The Mandalorian &lt;3x01&gt; <a href="https://www.tvmaze.com/episodes/1?a=1&amp;b=2">The Mandalorian</a><br>⚠️ <font data-mx-color="#ff8800"><b>Wind warning</b></font>`},
+		{"unknown", "Next episode of The Mandalorian <3x01> https://www.tvmaze.com/episodes/1?a=1&b=2 | Wind warning"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			if got := Render(tt.format, lines); got != tt.want {
+				t.Errorf("Render() = '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderEscapes(t *testing.T) {
+	tests := []struct {
+		format Format
+		line   Line
+		want   string
+	}{
+		{Discord, Line{Text: "*not bold* and_under"}, `\*not bold\* and\_under`},
+		{Slack, Line{Text: "a & b", URL: "https://example.com"}, "a &amp; b <https://example.com>"},
+		{Telegram, Line{Title: "<Show>", URL: "https://example.com"}, `<a href="https://example.com">&lt;Show&gt;</a>`},
+		{Matrix, Line{Text: "error", Severity: "error"}, `❌ <font data-mx-color="#ff0000"><b>error</b></font>`},
+	}
+	for _, tt := range tests {
+		if got := Render(tt.format, []Line{tt.line}); got != tt.want {
+			t.Errorf("Render(%s) = '%v', want '%v'", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, ok := ParseFormat(" Slack "); !ok || f != Slack {
+		t.Errorf("ParseFormat(Slack) = %v, %v", f, ok)
+	}
+	if _, ok := ParseFormat("myspace"); ok {
+		t.Error("ParseFormat() accepted an unknown format")
+	}
+}
@@ -0,0 +1,201 @@
+package render
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Ellipsis marks a result cut short by the message limit
+const Ellipsis = "…"
+
+// Limit is the size of a single message and how many messages a result may take
+type Limit struct {
+	// MaxBytes is the longest message in bytes, zero is unlimited
+	MaxBytes int
+	// MaxMessages is the most messages a result is split into, zero is unlimited
+	MaxMessages int
+}
+
+// DefaultLimit is the message size of the format, IRC leaves room for the PRIVMSG prefix in its 512 byte lines
+func DefaultLimit(format Format) Limit {
+	switch format {
+	case IRC:
+		return Limit{MaxBytes: 400}
+	case Slack:
+		return Limit{MaxBytes: 4000}
+	case Discord:
+		return Limit{MaxBytes: 2000}
+	case Telegram:
+		return Limit{MaxBytes: 4096}
+	default:
+		return Limit{}
+	}
+}
+
+// piece is a rendered part of a line that fits in a message, with the neutral line it was rendered from
+type piece struct {
+	text string
+	line Line
+}
+
+// Split renders the lines in the format and packs them into messages joined with the separator of the format.
+// Lines longer than a message are split between words of their text before rendering, so every message
+// has complete markup: severity styles are repeated on each part and the link goes with the last one.
+// Multibyte runes are never broken. If there are more messages than the limit allows the last one ends with Ellipsis.
+func Split(format Format, lines []Line, limit Limit) []string {
+	r := rendererFor(format)
+
+	var (
+		messages [][]piece
+		current  []piece
+		size     int
+	)
+	for _, line := range lines {
+		for _, p := range r.pieces(line, limit.MaxBytes) {
+			switch {
+			case len(current) == 0:
+				current, size = []piece{p}, len(p.text)
+			case limit.MaxBytes == 0 || size+len(r.separator)+len(p.text) <= limit.MaxBytes:
+				current, size = append(current, p), size+len(r.separator)+len(p.text)
+			default:
+				messages = append(messages, current)
+				current, size = []piece{p}, len(p.text)
+			}
+		}
+	}
+	if len(current) > 0 {
+		messages = append(messages, current)
+	}
+
+	if limit.MaxMessages > 0 && len(messages) > limit.MaxMessages {
+		messages = messages[:limit.MaxMessages]
+		last := len(messages) - 1
+		messages[last] = r.withEllipsis(messages[last], limit.MaxBytes)
+	}
+
+	out := make([]string, len(messages))
+	for i, message := range messages {
+		out[i] = r.join(message)
+	}
+	return out
+}
+
+// join puts the pieces of a message together with the separator
+func (r renderer) join(pieces []piece) string {
+	texts := make([]string, len(pieces))
+	for i, p := range pieces {
+		texts[i] = p.text
+	}
+	return strings.Join(texts, r.separator)
+}
+
+// withEllipsis makes room for Ellipsis at the end of the message by dropping or cutting its last pieces,
+// the ellipsis goes after the markup of the last piece
+func (r renderer) withEllipsis(pieces []piece, maxBytes int) []piece {
+	if maxBytes > 0 {
+		for len(pieces) > 1 && len(r.join(pieces))+len(Ellipsis) > maxBytes {
+			pieces = pieces[:len(pieces)-1]
+		}
+		if last := pieces[0]; len(pieces) == 1 && len(last.text)+len(Ellipsis) > maxBytes {
+			pieces = r.pieces(last.line, maxBytes-len(Ellipsis))[:1]
+		}
+	}
+
+	last := &pieces[len(pieces)-1]
+	last.text += Ellipsis
+	return pieces
+}
+
+// pieces renders the line, split into pieces of at most maxBytes between words of its text.
+// A link that doesn't fit with the end of the text gets a piece of its own, links themselves are never cut.
+func (r renderer) pieces(l Line, maxBytes int) []piece {
+	rendered := r.line(l)
+	if maxBytes <= 0 || len(rendered) <= maxBytes {
+		return []piece{{text: rendered, line: l}}
+	}
+
+	var pieces []piece
+	text := l.Text
+	for text != "" {
+		rest := l
+		rest.Text = text
+		if s := r.line(rest); len(s) <= maxBytes {
+			return append(pieces, piece{text: s, line: rest})
+		}
+
+		var head Line
+		head, text = r.cutText(text, l.Severity, maxBytes)
+		pieces = append(pieces, piece{text: r.line(head), line: head})
+	}
+
+	link := Line{Title: l.Title, URL: l.URL}
+	if link.URL != "" {
+		pieces = append(pieces, piece{text: r.line(link), line: link})
+	}
+	return pieces
+}
+
+// cutText returns the longest start of the text, ending between words, that renders within maxBytes
+// with the severity style, and the rest. Escaping and styles add bytes, so the cut is moved back until it fits.
+func (r renderer) cutText(text, severity string, maxBytes int) (Line, string) {
+	budget := maxBytes
+	for {
+		head, rest := cut(text, budget)
+		line := Line{Text: head, Severity: severity}
+		over := len(r.line(line)) - maxBytes
+		if over <= 0 || budget == 1 {
+			// with absurdly small limits a single rune and its markup can be over the limit
+			return line, rest
+		}
+		budget = max(budget-over, 1)
+	}
+}
+
+// cut returns the longest prefix of at most maxBytes ending between words, and the rest without the leading spaces.
+// Words longer than maxBytes are cut at a rune boundary.
+func cut(s string, maxBytes int) (head, rest string) {
+	if len(s) <= maxBytes {
+		return s, ""
+	}
+
+	// never end inside a multibyte rune
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+
+	if space := strings.LastIndexByte(s[:end+1], ' '); space > 0 {
+		end = space
+	}
+	if end == 0 {
+		// a single rune longer than the limit, only possible with absurdly small limits
+		_, end = utf8.DecodeRuneInString(s)
+	}
+
+	return strings.TrimRight(s[:end], " "), strings.TrimLeft(s[end:], " ")
+}
+
+// ParseLimit reads a limit written as "<bytes>" or "<bytes>/<messages>", e.g. "400/3"
+func ParseLimit(s string) (Limit, error) {
+	bytesPart, messagesPart, hasMessages := strings.Cut(strings.TrimSpace(s), "/")
+
+	var (
+		l   Limit
+		err error
+	)
+	if l.MaxBytes, err = strconv.Atoi(bytesPart); err != nil || l.MaxBytes < 0 {
+		return Limit{}, fmt.Errorf("invalid message limit %q, use <bytes> or <bytes>/<messages>", s)
+	}
+	if hasMessages {
+		if l.MaxMessages, err = strconv.Atoi(messagesPart); err != nil || l.MaxMessages < 0 {
+			return Limit{}, fmt.Errorf("invalid message limit %q, use <bytes> or <bytes>/<messages>", s)
+		}
+	}
+	// the ellipsis has to fit in the last message
+	if l.MaxBytes > 0 && l.MaxBytes <= len(Ellipsis) {
+		return Limit{}, fmt.Errorf("message limit %q is too small", s)
+	}
+	return l, nil
+}
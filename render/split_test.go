@@ -0,0 +1,159 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		limit Limit
+		want  []string
+	}{
+		{"no limit", []string{"a", "b"}, Limit{}, []string{"a | b"}},
+		{"lines fit one message", []string{"one", "two"}, Limit{MaxBytes: 9}, []string{"one | two"}},
+		{"lines over two messages", []string{"one", "two", "three"}, Limit{MaxBytes: 10}, []string{"one | two", "three"}},
+		{"long line between words", []string{"the quick brown fox jumps"}, Limit{MaxBytes: 10}, []string{"the quick", "brown fox", "jumps"}},
+		{"word longer than limit", []string{"abcdefghij"}, Limit{MaxBytes: 4}, []string{"abcd", "efgh", "ij"}},
+		{"multibyte runes", []string{"ääää"}, Limit{MaxBytes: 5}, []string{"ää", "ää"}},
+		{"max messages", []string{"one", "two", "three"}, Limit{MaxBytes: 5, MaxMessages: 2}, []string{"one", "tw…"}},
+		{"max messages without byte limit", []string{"one", "two"}, Limit{MaxMessages: 1}, []string{"one | two"}},
+		{"empty", nil, Limit{MaxBytes: 10}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(Plain, plainLines(tt.lines...), tt.limit)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") || len(got) != len(tt.want) {
+				t.Errorf("Split() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitLimits(t *testing.T) {
+	// an IRC sized limit on a long Finnish text, every message must fit and stay valid UTF-8
+	line := strings.Repeat("Sähkön hinta on tänään erittäin korkea, käytä pesukonetta yöllä. ", 30)
+	limit := Limit{MaxBytes: 400, MaxMessages: 3}
+
+	got := Split(Plain, plainLines(line), limit)
+	if len(got) != 3 {
+		t.Fatalf("Split() = %d messages, want 3", len(got))
+	}
+	for i, m := range got {
+		if len(m) > limit.MaxBytes {
+			t.Errorf("message %d is %d bytes, want at most %d", i, len(m), limit.MaxBytes)
+		}
+		if !utf8.ValidString(m) {
+			t.Errorf("message %d isn't valid UTF-8: %q", i, m)
+		}
+	}
+	if !strings.HasSuffix(got[2], Ellipsis) {
+		t.Errorf("last message '%v' doesn't end with %s", got[2], Ellipsis)
+	}
+}
+
+func TestSplitFormatted(t *testing.T) {
+	long := "Sähkö & kaasu <kallista> " + strings.Repeat("hinta nousee taas ", 5)
+	lines := []Line{
+		{Text: long, Severity: "warning", Title: "Pörssisähkö", URL: "https://example.com/sahko?a=1&b=2"},
+		{Text: "toinen rivi"},
+	}
+
+	tests := []struct {
+		format Format
+		limit  Limit
+		// every message must have balanced markup
+		open, close string
+	}{
+		{IRC, Limit{MaxBytes: 40}, "\x02\x0307", "\x0F"},
+		{IRC, Limit{MaxBytes: 40, MaxMessages: 2}, "\x02\x0307", "\x0F"},
+		{Telegram, Limit{MaxBytes: 70}, "<b>", "</b>"},
+		{Telegram, Limit{MaxBytes: 70, MaxMessages: 2}, "<b>", "</b>"},
+		{Matrix, Limit{MaxBytes: 90}, "<font", "</font>"},
+		{Slack, Limit{MaxBytes: 50}, ":warning: *", "*"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %d/%d", tt.format, tt.limit.MaxBytes, tt.limit.MaxMessages), func(t *testing.T) {
+			got := Split(tt.format, lines, tt.limit)
+			if len(got) < 2 {
+				t.Fatalf("Split() = %q, want several messages", got)
+			}
+
+			var text strings.Builder
+			for i, m := range got {
+				if len(m) > tt.limit.MaxBytes {
+					t.Errorf("message %d is %d bytes, want at most %d: %q", i, len(m), tt.limit.MaxBytes, m)
+				}
+				if !utf8.ValidString(m) {
+					t.Errorf("message %d isn't valid UTF-8: %q", i, m)
+				}
+				open := strings.Count(m, unquote(tt.open))
+				if closing := strings.Count(m, unquote(tt.close)); tt.open != tt.close && open > closing {
+					t.Errorf("message %d leaves formatting open: %q", i, m)
+				}
+				if strings.Count(m, "<")-strings.Count(m, ">") != 0 && tt.format != Slack {
+					t.Errorf("message %d has a tag cut in half: %q", i, m)
+				}
+				text.WriteString(m)
+			}
+
+			// the link is never cut, unless the last message had to be
+			if tt.limit.MaxMessages == 0 && !strings.Contains(text.String(), "example.com/sahko?a=1") {
+				t.Errorf("Split() = %q, want the link in one piece", got)
+			}
+		})
+	}
+}
+
+func TestSplitFormattedParts(t *testing.T) {
+	lines := []Line{{Text: "one two three four", Severity: "error"}}
+
+	got := Split(IRC, lines, Limit{MaxBytes: 15})
+	want := []string{"\x02\x0304one two\x0F", "\x02\x0304three four\x0F"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Split() = %q, want %q", got, want)
+	}
+
+	got = Split(Telegram, []Line{{Text: "a & b & c", Title: "x", URL: "https://e.com"}}, Limit{MaxBytes: 20})
+	want = []string{"a &amp; b &amp; c", `<a href="https://e.com">x</a>`}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Split() = %q, want %q", got, want)
+	}
+}
+
+func plainLines(texts ...string) []Line {
+	lines := make([]Line, len(texts))
+	for i, text := range texts {
+		lines[i] = Line{Text: text}
+	}
+	return lines
+}
+
+func unquote(s string) string {
+	return strings.NewReplacer(`\x02`, "\x02", `\x03`, "\x03", `\x0F`, "\x0F").Replace(s)
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"400", Limit{MaxBytes: 400}, false},
+		{"400/3", Limit{MaxBytes: 400, MaxMessages: 3}, false},
+		{"0/2", Limit{MaxMessages: 2}, false},
+		{"lots", Limit{}, true},
+		{"400/x", Limit{}, true},
+		{"2", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLimit(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lepinkainen/lambdabot/config"
+	"github.com/lepinkainen/lambdabot/lambda"
+	"github.com/lepinkainen/lambdabot/metrics"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const replHelp = `Type a command and its arguments, e.g. "ep mandalorian" or "weather Tampere".
+  :user <name>     set the user of the commands
+  :source <name>   set the source of the commands
+  :json            toggle printing the raw JSON response
+  :history         list previous commands
+  !<n>             run command number n from the history again
+  :help            show this help
+  :quit            exit`
+
+// repl is an interactive shell for running commands locally
+type repl struct {
+	in      *bufio.Scanner
+	out     io.Writer
+	user    string
+	source  string
+	json    bool
+	history []string
+	// historyFile persists the history between sessions, empty disables it
+	historyFile string
+}
+
+// runREPL starts an interactive shell on stdin and stdout
+func runREPL() {
+	// keep the log lines from drowning the results
+	log.SetOutput(os.Stderr)
+	log.SetLevel(log.WarnLevel)
+	// metrics only go to METRICS_FILE, EMF lines on stdout would drown the results too
+	if !config.IsSet("METRICS_FILE") {
+		lambda.SetMetrics(metrics.New(io.Discard, ""))
+	}
+
+	r := &repl{
+		in:     bufio.NewScanner(os.Stdin),
+		out:    os.Stdout,
+		user:   "repl",
+		source: "repl",
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		r.historyFile = filepath.Join(home, ".lambdabot_history")
+	}
+
+	r.loadHistory()
+	fmt.Fprintln(r.out, "lambdabot REPL, :help for help")
+	r.run(context.Background())
+}
+
+// run reads lines until EOF or :quit
+func (r *repl) run(ctx context.Context) {
+	for {
+		fmt.Fprintf(r.out, "%s@%s> ", r.user, r.source)
+		if !r.in.Scan() {
+			fmt.Fprintln(r.out)
+			return
+		}
+
+		line := strings.TrimSpace(r.in.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "!") {
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(r.history) {
+				fmt.Fprintf(r.out, "No history entry %s\n", line[1:])
+				continue
+			}
+			line = r.history[n-1]
+			fmt.Fprintln(r.out, line)
+		}
+
+		if strings.HasPrefix(line, ":") {
+			if quit := r.meta(line); quit {
+				return
+			}
+			continue
+		}
+
+		r.addHistory(line)
+		r.execute(ctx, line)
+	}
+}
+
+// meta handles the REPL's own commands, returns true when the REPL should exit
+func (r *repl) meta(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":quit", ":q", ":exit":
+		return true
+	case ":user":
+		r.user = arg
+	case ":source":
+		r.source = arg
+	case ":json":
+		r.json = !r.json
+		fmt.Fprintf(r.out, "JSON output %s\n", map[bool]string{true: "on", false: "off"}[r.json])
+	case ":history":
+		for i, entry := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, entry)
+		}
+	case ":help":
+		fmt.Fprintln(r.out, replHelp)
+	default:
+		fmt.Fprintf(r.out, "Unknown REPL command %s, :help for help\n", name)
+	}
+	return false
+}
+
+// execute runs a single command line and prints the result, timing and error
+func (r *repl) execute(ctx context.Context, line string) {
+	name, args, _ := strings.Cut(line, " ")
+	cmd := &lambda.Command{
+		User:      r.user,
+		Source:    r.source,
+		Command:   name,
+		Arguments: strings.TrimSpace(args),
+	}
+
+	start := time.Now()
+	res, err := lambda.HandleRequest(ctx, cmd)
+	elapsed := time.Since(start)
+
+	if r.json {
+		encoder := json.NewEncoder(r.out)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		_ = encoder.Encode(res)
+	} else {
+		for _, l := range res.Lines {
+			fmt.Fprintln(r.out, l.Text)
+		}
+		if len(res.Lines) == 0 {
+			fmt.Fprintln(r.out, "(no result)")
+		}
+	}
+
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+	}
+	fmt.Fprintf(r.out, "(%s)\n", elapsed.Round(time.Microsecond))
+}
+
+func (r *repl) addHistory(line string) {
+	r.history = append(r.history, line)
+
+	if r.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(r.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+func (r *repl) loadHistory() {
+	if r.historyFile == "" {
+		return
+	}
+	data, err := os.ReadFile(r.historyFile)
+	if err != nil {
+		return
+	}
+	for line := range strings.SplitSeq(strings.TrimSpace(string(data)), "\n") {
+		if line != "" {
+			r.history = append(r.history, line)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	input := strings.Join([]string{
+		"echo hello world",
+		":user nick",
+		":source #channel",
+		"echo again",
+		":history",
+		"!1",
+		":json",
+		"echo raw",
+		":quit",
+		"echo never runs",
+	}, "\n")
+
+	var out bytes.Buffer
+	r := &repl{
+		in:     bufio.NewScanner(strings.NewReader(input)),
+		out:    &out,
+		user:   "repl",
+		source: "repl",
+	}
+	r.run(context.Background())
+
+	got := out.String()
+	for _, want := range []string{
+		"repl@repl> hello world\n",
+		"nick@#channel> again\n",
+		"   1  echo hello world\n   2  echo again\n",
+		"nick@#channel> echo hello world\nhello world\n",
+		"JSON output on",
+		`"user": "nick"`,
+		`"result": "raw"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output doesn't contain %q:\n%s", want, got)
+		}
+	}
+
+	if strings.Contains(got, "never runs") {
+		t.Errorf("commands after :quit were run:\n%s", got)
+	}
+	if len(r.history) != 4 {
+		t.Errorf("history = %v, want 4 entries", r.history)
+	}
+}
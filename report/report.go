@@ -0,0 +1,175 @@
+// Package report sends incidents to an error tracker that accepts Sentry envelopes,
+// such as Sentry itself, GlitchTip or a local stand-in
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Frame is a single function call of a stack trace
+type Frame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+}
+
+// Event is an incident to report
+type Event struct {
+	// Type is the kind of failure, e.g. "panic"
+	Type string
+	// Value is the failure itself, e.g. the panic message
+	Value string
+	// Frames is the stack trace, innermost call first as returned by Callers
+	Frames []Frame
+	// Tags are indexed by the tracker, e.g. the command and source
+	Tags map[string]string
+	// Extra is free-form data shown with the event
+	Extra map[string]any
+}
+
+// Callers returns the stack of the calling goroutine, skipping the given number of frames on top of Callers itself
+func Callers(skip int) []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+
+	var out []Frame
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		f, more := frames.Next()
+		out = append(out, Frame{Function: f.Function, Filename: f.File, Lineno: f.Line})
+		if !more {
+			break
+		}
+	}
+	return out
+}
+
+// Client posts events to the envelope endpoint of a DSN
+type Client struct {
+	dsn      string
+	endpoint string
+	key      string
+	release  string
+	client   *http.Client
+}
+
+// New parses a DSN like https://<key>@sentry.example.com/<project>
+func New(dsn, release string) (*Client, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DSN: %v", err)
+	}
+
+	project := strings.Trim(u.Path, "/")
+	if u.Scheme == "" || u.Host == "" || u.User == nil || u.User.Username() == "" || project == "" {
+		return nil, fmt.Errorf("invalid DSN %q, use <scheme>://<key>@<host>/<project>", dsn)
+	}
+
+	return &Client{
+		dsn:      dsn,
+		endpoint: fmt.Sprintf("%s://%s/api/%s/envelope/", u.Scheme, u.Host, project),
+		key:      u.User.Username(),
+		release:  release,
+		client:   &http.Client{Timeout: 3 * time.Second},
+	}, nil
+}
+
+// event is the Sentry event payload
+type event struct {
+	EventID   string            `json:"event_id"`
+	Timestamp string            `json:"timestamp"`
+	Platform  string            `json:"platform"`
+	Level     string            `json:"level"`
+	Logger    string            `json:"logger"`
+	Release   string            `json:"release,omitempty"`
+	Exception exceptions        `json:"exception"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Extra     map[string]any    `json:"extra,omitempty"`
+}
+
+type exceptions struct {
+	Values []exception `json:"values"`
+}
+
+type exception struct {
+	Type       string     `json:"type"`
+	Value      string     `json:"value"`
+	Stacktrace stacktrace `json:"stacktrace"`
+}
+
+type stacktrace struct {
+	Frames []Frame `json:"frames"`
+}
+
+// Capture sends the event and returns its ID
+func (c *Client) Capture(ctx context.Context, e Event) (string, error) {
+	id := newEventID()
+
+	// Sentry wants the outermost call first
+	frames := make([]Frame, len(e.Frames))
+	for i, f := range e.Frames {
+		frames[len(frames)-1-i] = f
+	}
+
+	payload, err := json.Marshal(event{
+		EventID:   id,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Platform:  "go",
+		Level:     "fatal",
+		Logger:    "lambdabot",
+		Release:   c.release,
+		Exception: exceptions{Values: []exception{{Type: e.Type, Value: e.Value, Stacktrace: stacktrace{Frames: frames}}}},
+		Tags:      e.Tags,
+		Extra:     e.Extra,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// an envelope is a header line followed by an item header and payload line per item
+	var body bytes.Buffer
+	header, _ := json.Marshal(map[string]string{"event_id": id, "dsn": c.dsn, "sent_at": time.Now().UTC().Format(time.RFC3339)})
+	itemHeader, _ := json.Marshal(map[string]any{"type": "event", "length": len(payload)})
+	for _, line := range [][]byte{header, itemHeader, payload} {
+		body.Write(line)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=lambdabot, sentry_key=%s", c.key))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("unable to report event: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("unable to report event: tracker returned %d", resp.StatusCode)
+	}
+	return id, nil
+}
+
+func newEventID() string {
+	var id [16]byte
+	for i := range id {
+		id[i] = byte(rand.Uint32())
+	}
+	return hex.EncodeToString(id[:])
+}
@@ -0,0 +1,89 @@
+package report
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	c, err := New("https://abc123@sentry.example.com/42", "v1")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if c.endpoint != "https://sentry.example.com/api/42/envelope/" || c.key != "abc123" {
+		t.Errorf("New() endpoint = '%v', key = '%v'", c.endpoint, c.key)
+	}
+
+	for _, dsn := range []string{"", "not a url", "https://sentry.example.com/42", "https://key@sentry.example.com/"} {
+		if _, err := New(dsn, ""); err == nil {
+			t.Errorf("New(%q) accepted an invalid DSN", dsn)
+		}
+	}
+}
+
+func TestCapture(t *testing.T) {
+	var lines []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/1/envelope/" {
+			t.Errorf("posted to %s, want /api/1/envelope/", r.URL.Path)
+		}
+		if !strings.Contains(r.Header.Get("X-Sentry-Auth"), "sentry_key=key") {
+			t.Errorf("X-Sentry-Auth = '%v'", r.Header.Get("X-Sentry-Auth"))
+		}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+	}))
+	defer server.Close()
+
+	c, err := New(strings.Replace(server.URL, "://", "://key@", 1)+"/1", "v1")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	id, err := c.Capture(context.Background(), Event{
+		Type:   "panic",
+		Value:  "index out of range",
+		Frames: Callers(0),
+		Tags:   map[string]string{"command": "ep"},
+	})
+	if err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+
+	if len(lines) != 3 {
+		t.Fatalf("envelope has %d lines, want header, item header and event", len(lines))
+	}
+
+	var got struct {
+		EventID   string            `json:"event_id"`
+		Tags      map[string]string `json:"tags"`
+		Exception struct {
+			Values []struct {
+				Type       string `json:"type"`
+				Value      string `json:"value"`
+				Stacktrace struct {
+					Frames []Frame `json:"frames"`
+				} `json:"stacktrace"`
+			} `json:"values"`
+		} `json:"exception"`
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &got); err != nil {
+		t.Fatalf("invalid event: %v", err)
+	}
+	if got.EventID != id || got.Tags["command"] != "ep" || got.Exception.Values[0].Value != "index out of range" {
+		t.Errorf("Capture() sent %+v", got)
+	}
+
+	// the innermost frame is last
+	frames := got.Exception.Values[0].Stacktrace.Frames
+	if len(frames) == 0 || !strings.HasSuffix(frames[len(frames)-1].Function, "TestCapture") {
+		t.Errorf("stack trace = %+v, want TestCapture last", frames)
+	}
+}
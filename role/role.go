@@ -0,0 +1,176 @@
+// Package role stores what users are allowed to do in each source
+package role
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Role is the level of trust of a user, higher roles can do everything lower ones can
+type Role int
+
+// Roles from least to most trusted, the zero value is a normal user
+const (
+	Banned Role = iota - 1
+	Normal
+	Trusted
+	Admin
+)
+
+// AnySource assigns a role in every source, a role in a specific source overrides it
+const AnySource = "*"
+
+var names = map[Role]string{
+	Banned:  "banned",
+	Normal:  "normal",
+	Trusted: "trusted",
+	Admin:   "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := names[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("role(%d)", int(r))
+}
+
+// Parse returns the role with the given name
+func Parse(name string) (Role, error) {
+	for r, n := range names {
+		if strings.EqualFold(n, name) {
+			return r, nil
+		}
+	}
+	return Normal, fmt.Errorf("unknown role %q, use banned, normal, trusted or admin", name)
+}
+
+// Store keeps role assignments of users per source
+type Store interface {
+	// Get returns the role of the user in the source, ok is false if none is assigned
+	Get(ctx context.Context, source, user string) (r Role, ok bool, err error)
+	Set(ctx context.Context, source, user string, r Role) error
+	Delete(ctx context.Context, source, user string) error
+	// List returns the assigned roles by user in the source
+	List(ctx context.Context, source string) (map[string]Role, error)
+}
+
+// Resolve returns the role of the user in the source, falling back to the role in any source and then Normal
+func Resolve(ctx context.Context, store Store, source, user string) (Role, error) {
+	for _, s := range []string{source, AnySource} {
+		r, ok, err := store.Get(ctx, s, user)
+		if err != nil {
+			return Normal, err
+		}
+		if ok {
+			return r, nil
+		}
+	}
+	return Normal, nil
+}
+
+// MemoryStore keeps roles in process memory
+type MemoryStore struct {
+	mu    sync.Mutex
+	roles map[string]map[string]Role
+}
+
+// NewMemoryStore returns an empty in-memory role store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{roles: make(map[string]map[string]Role)}
+}
+
+// Get returns the role of the user in the source
+func (m *MemoryStore) Get(_ context.Context, source, user string) (Role, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.roles[source][user]
+	return r, ok, nil
+}
+
+// Set assigns a role to the user in the source
+func (m *MemoryStore) Set(_ context.Context, source, user string, r Role) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.roles[source] == nil {
+		m.roles[source] = make(map[string]Role)
+	}
+	m.roles[source][user] = r
+	return nil
+}
+
+// Delete removes the role of the user in the source
+func (m *MemoryStore) Delete(_ context.Context, source, user string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.roles[source], user)
+	return nil
+}
+
+// List returns a copy of the roles in the source
+func (m *MemoryStore) List(_ context.Context, source string) (map[string]Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return maps.Clone(m.roles[source]), nil
+}
+
+// keyPrefix is followed by the source, each source is a hash of user to role name
+const keyPrefix = "roles:"
+
+// RedisStore keeps roles in Redis
+type RedisStore struct {
+	client redis.Cmdable
+}
+
+// NewRedisStore returns a store keeping the roles in the given Redis
+func NewRedisStore(client redis.Cmdable) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// Get returns the role of the user in the source
+func (s *RedisStore) Get(ctx context.Context, source, user string) (Role, bool, error) {
+	name, err := s.client.HGet(ctx, keyPrefix+source, user).Result()
+	if errors.Is(err, redis.Nil) {
+		return Normal, false, nil
+	}
+	if err != nil {
+		return Normal, false, err
+	}
+
+	r, err := Parse(name)
+	if err != nil {
+		return Normal, false, err
+	}
+	return r, true, nil
+}
+
+// Set assigns a role to the user in the source
+func (s *RedisStore) Set(ctx context.Context, source, user string, r Role) error {
+	return s.client.HSet(ctx, keyPrefix+source, user, r.String()).Err()
+}
+
+// Delete removes the role of the user in the source
+func (s *RedisStore) Delete(ctx context.Context, source, user string) error {
+	return s.client.HDel(ctx, keyPrefix+source, user).Err()
+}
+
+// List returns the roles in the source, unknown role names are skipped
+func (s *RedisStore) List(ctx context.Context, source string) (map[string]Role, error) {
+	all, err := s.client.HGetAll(ctx, keyPrefix+source).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]Role, len(all))
+	for user, name := range all {
+		if r, err := Parse(name); err == nil {
+			roles[user] = r
+		}
+	}
+	return roles, nil
+}
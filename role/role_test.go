@@ -0,0 +1,49 @@
+package role
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for r := Banned; r <= Admin; r++ {
+		got, err := Parse(r.String())
+		if err != nil || got != r {
+			t.Errorf("Parse(%v) = %v, %v", r, got, err)
+		}
+	}
+
+	if _, err := Parse("owner"); err == nil {
+		t.Error("Parse() accepted an unknown role")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	_ = store.Set(ctx, AnySource, "ops", Admin)
+	_ = store.Set(ctx, "#strict", "ops", Normal)
+	_ = store.Set(ctx, "#channel", "spammer", Banned)
+
+	tests := []struct {
+		source, user string
+		want         Role
+	}{
+		{"#channel", "ops", Admin},
+		{"#strict", "ops", Normal},
+		{"#channel", "spammer", Banned},
+		{"#other", "spammer", Normal},
+		{"#channel", "nick", Normal},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(ctx, store, tt.source, tt.user)
+		if err != nil || got != tt.want {
+			t.Errorf("Resolve(%s, %s) = %v, %v, want %v", tt.source, tt.user, got, err, tt.want)
+		}
+	}
+
+	_ = store.Delete(ctx, "#channel", "spammer")
+	if got, _ := Resolve(ctx, store, "#channel", "spammer"); got != Normal {
+		t.Errorf("Resolve() after Delete() = %v, want normal", got)
+	}
+}
@@ -48,6 +48,16 @@ else
     exit 1
 fi
 
+echo "Testing batch of commands..."
+result=$(echo '[{"command":"echo","args":"first"},{"command":"echo","args":"second"}]' | RUNMODE=stdout ./lambdabot 2>/dev/null)
+if echo "$result" | grep -q '"result": "first"' && echo "$result" | grep -q '"result": "second"'; then
+    echo "✅ Batch test passed"
+else
+    echo "❌ Batch test failed"
+    echo "Got: $result"
+    exit 1
+fi
+
 echo ""
 echo "🎉 All local integration tests passed!"
 echo "RUNMODE=stdout functionality is working correctly."
\ No newline at end of file